@@ -0,0 +1,226 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ArgumentError reports a command argument that cannot be represented on the wire.
+type ArgumentError struct {
+	Command string // Command is the keyword of the command being built.
+	Arg     string // Arg is the offending argument.
+	Reason  string // Reason explains why the argument was rejected.
+}
+
+func (e *ArgumentError) Error() string {
+	return fmt.Sprintf("invalid argument %q for %s: %s", e.Arg, e.Command, e.Reason)
+}
+
+// commandBuilder assembles a command line one argument at a time. Commands are
+// space separated, so keys and values are passed through quoteArg; the first
+// invalid argument is remembered and reported by build.
+//
+// Keys, names and IDs go through key, which rejects values the server cannot
+// store as a name. Free-form payloads go through value, which accepts anything
+// that is valid UTF-8, spaces and newlines included.
+type commandBuilder struct {
+	name string
+	args []string
+	err  error
+}
+
+func newCommand(name string) *commandBuilder {
+	return &commandBuilder{name: name}
+}
+
+// key appends an identifier: a key, channel, stream, queue, document ID or field path.
+func (cb *commandBuilder) key(k string) *commandBuilder {
+	if cb.err == nil {
+		if reason := invalidKey(k); reason != "" {
+			cb.err = &ArgumentError{Command: cb.name, Arg: k, Reason: reason}
+			return cb
+		}
+	}
+	cb.args = append(cb.args, quoteArg(k))
+	return cb
+}
+
+// value appends a free-form string argument.
+func (cb *commandBuilder) value(v string) *commandBuilder {
+	if cb.err == nil && !utf8.ValidString(v) {
+		cb.err = &ArgumentError{Command: cb.name, Arg: v, Reason: "value is not valid UTF-8"}
+		return cb
+	}
+	cb.args = append(cb.args, quoteArg(v))
+	return cb
+}
+
+// int appends an integer argument.
+func (cb *commandBuilder) int(n int) *commandBuilder {
+	cb.args = append(cb.args, strconv.Itoa(n))
+	return cb
+}
+
+// int64 appends a 64-bit integer argument, such as a Unix timestamp.
+func (cb *commandBuilder) int64(n int64) *commandBuilder {
+	cb.args = append(cb.args, strconv.FormatInt(n, 10))
+	return cb
+}
+
+// json appends v encoded as JSON. The server parses JSON arguments itself, so the
+// encoding is sent verbatim; encoding/json escapes every control character, so
+// it cannot break the line framing.
+func (cb *commandBuilder) json(v interface{}) *commandBuilder {
+	jsonValue, err := json.Marshal(v)
+	if err != nil {
+		if cb.err == nil {
+			cb.err = err
+		}
+		return cb
+	}
+	cb.args = append(cb.args, string(jsonValue))
+	return cb
+}
+
+// build returns the command line without its terminator.
+func (cb *commandBuilder) build() (string, error) {
+	if cb.err != nil {
+		return "", cb.err
+	}
+	if len(cb.args) == 0 {
+		return cb.name, nil
+	}
+	return cb.name + " " + strings.Join(cb.args, " "), nil
+}
+
+// invalidKey returns why k cannot be used as an identifier, or "" if it can.
+func invalidKey(k string) string {
+	if k == "" {
+		return "must not be empty"
+	}
+	if !utf8.ValidString(k) {
+		return "must be valid UTF-8"
+	}
+	for _, r := range k {
+		if unicode.IsControl(r) {
+			return "must not contain control characters"
+		}
+	}
+	return ""
+}
+
+// needsQuoting reports whether s would not survive being sent as a bare token.
+func needsQuoting(s string) bool {
+	if s == "" || s[0] == '"' {
+		return true
+	}
+	for _, r := range s {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteArg renders s as a single protocol token. Tokens without whitespace or
+// control characters are sent verbatim, so ordinary keys and values look exactly
+// as before. Anything else is wrapped in double quotes with '"' and '\'
+// backslash-escaped, \n, \r and \t spelled out and other control characters
+// written as \xHH, so no argument can break the line framing.
+func quoteArg(s string) string {
+	if !needsQuoting(s) {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\x%02x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// nextArg reads the first protocol token from s, reversing quoteArg if it is
+// quoted, and returns it together with the remainder of s.
+func nextArg(s string) (arg, rest string, err error) {
+	s = strings.TrimLeft(s, " ")
+	if !strings.HasPrefix(s, `"`) {
+		arg, rest, _ = strings.Cut(s, " ")
+		return arg, rest, nil
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if c == '"' {
+			return b.String(), strings.TrimLeft(s[i+1:], " "), nil
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+
+		i++
+		if i == len(s) {
+			break
+		}
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'x':
+			if i+2 >= len(s) {
+				return "", "", fmt.Errorf("truncated escape in %q", s)
+			}
+			n, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return "", "", fmt.Errorf("invalid escape in %q", s)
+			}
+			b.WriteByte(byte(n))
+			i += 2
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", fmt.Errorf("unterminated quoted argument %q", s)
+}
+
+// rawCommand builds a command whose arguments are already encoded, such as a query
+// pipeline. rest is sent verbatim and so must not contain control characters.
+func rawCommand(name, rest string) *commandBuilder {
+	cb := newCommand(name)
+	for _, r := range rest {
+		if unicode.IsControl(r) {
+			cb.err = &ArgumentError{Command: name, Arg: rest, Reason: "must not contain control characters"}
+			return cb
+		}
+	}
+	cb.args = append(cb.args, rest)
+	return cb
+}
@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestQuoteArgRoundTrip(t *testing.T) {
+	tests := []struct {
+		arg    string
+		quoted string
+	}{
+		{"plain", "plain"},
+		{`{"a":1}`, `{"a":1}`},
+		{"", `""`},
+		{"two words", `"two words"`},
+		{`"leading`, `"\"leading"`},
+		{`back\slash and space`, `"back\\slash and space"`},
+		{"line\nbreak", `"line\nbreak"`},
+		{"cr\rtab\t", `"cr\rtab\t"`},
+		{"bell\x07del\x7f", `"bell\x07del\x7f"`},
+		{"héllo wörld", `"héllo wörld"`},
+	}
+	for _, tt := range tests {
+		quoted := quoteArg(tt.arg)
+		if quoted != tt.quoted {
+			t.Errorf("quoteArg(%q) = %q, want %q", tt.arg, quoted, tt.quoted)
+		}
+		arg, rest, err := nextArg(quoted + " next")
+		if err != nil {
+			t.Errorf("nextArg(%q) returned %v", quoted, err)
+			continue
+		}
+		if arg != tt.arg || rest != "next" {
+			t.Errorf("nextArg(%q) = %q, %q, want %q, %q", quoted, arg, rest, tt.arg, "next")
+		}
+	}
+}
+
+func TestNextArgMalformed(t *testing.T) {
+	for _, s := range []string{
+		`"unterminated`,
+		`"trailing\`,
+		`"short\x4`,
+		`"bad\xzz"`,
+	} {
+		if arg, _, err := nextArg(s); err == nil {
+			t.Errorf("nextArg(%q) = %q, want an error", s, arg)
+		}
+	}
+}
+
+func TestCommandBuilderRejectsInvalidKeys(t *testing.T) {
+	for _, key := range []string{"", "new\nline", "nul\x00", "\xff"} {
+		_, err := newCommand("GET_KEY").key(key).build()
+		var argErr *ArgumentError
+		if !errors.As(err, &argErr) || argErr.Arg != key {
+			t.Errorf("key(%q) built with %v, want an ArgumentError", key, err)
+		}
+	}
+}
+
+func TestCommandBuilderSendsJSONVerbatim(t *testing.T) {
+	line, err := newCommand("SET").key("k").json(map[string]string{"text": "a b\n"}).build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `SET k {"text":"a b\n"}`; line != want {
+		t.Fatalf("build() = %q, want %q", line, want)
+	}
+}
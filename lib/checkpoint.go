@@ -0,0 +1,101 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// StreamCheckpoint persists how far a named consumer has processed a stream, as
+// the ID of the last processed entry stored under a key in TempDB. A consumer
+// that commits each entry only after processing it resumes after a restart from
+// the first entry it had not finished, so every entry is processed at least once.
+//
+//	cp := client.NewStreamCheckpoint("user_events", "emailer")
+//	err := cp.Process(ctx, tempdb.StreamReaderOptions{}, func(ctx context.Context, entry tempdb.StreamEntry) error {
+//		return sendEmail(entry.Values)
+//	})
+type StreamCheckpoint struct {
+	client    *TempDBClient
+	streamKey string
+	key       string
+}
+
+// NewStreamCheckpoint returns the checkpoint of consumer on streamKey.
+func (c *TempDBClient) NewStreamCheckpoint(streamKey, consumer string) *StreamCheckpoint {
+	return &StreamCheckpoint{
+		client:    c,
+		streamKey: streamKey,
+		key:       fmt.Sprintf("checkpoint:%s:%s", streamKey, consumer),
+	}
+}
+
+// Key returns the key the checkpoint is stored under.
+func (cp *StreamCheckpoint) Key() string {
+	return cp.key
+}
+
+// Load returns the ID of the last committed entry, or "" if nothing has been committed.
+func (cp *StreamCheckpoint) Load(ctx context.Context) (string, error) {
+	id, err := GetAsContext[string](ctx, cp.client, cp.key)
+	if errors.Is(err, ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load checkpoint %s: %w", cp.key, err)
+	}
+	return id, nil
+}
+
+// Commit records id as the last processed entry.
+func (cp *StreamCheckpoint) Commit(ctx context.Context, id string) error {
+	if err := cp.client.SetContext(ctx, cp.key, id); err != nil {
+		return fmt.Errorf("failed to commit checkpoint %s: %w", cp.key, err)
+	}
+	return nil
+}
+
+// Reset deletes the checkpoint, so the next reader starts from opts.StartID again.
+func (cp *StreamCheckpoint) Reset(ctx context.Context) error {
+	_, err := cp.client.DeleteContext(ctx, cp.key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to reset checkpoint %s: %w", cp.key, err)
+	}
+	return nil
+}
+
+// Reader returns a StreamReader that resumes after the last committed entry. When
+// nothing has been committed it starts from opts.StartID.
+func (cp *StreamCheckpoint) Reader(ctx context.Context, opts StreamReaderOptions) (*StreamReader, error) {
+	id, err := cp.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if id != "" {
+		opts.StartID = id
+	}
+	return cp.client.NewStreamReader(cp.streamKey, opts), nil
+}
+
+// Process reads the stream from the checkpoint and calls handler for each entry,
+// committing the entry once handler returns nil. It returns handler's error
+// without committing that entry, so it is processed again next time, or ctx's
+// error once ctx is done.
+func (cp *StreamCheckpoint) Process(ctx context.Context, opts StreamReaderOptions, handler func(ctx context.Context, entry StreamEntry) error) error {
+	reader, err := cp.Reader(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for entry, err := range reader.All(ctx) {
+		if err != nil {
+			return err
+		}
+		if err := handler(ctx, entry); err != nil {
+			return fmt.Errorf("failed to process entry %s: %w", entry.ID, err)
+		}
+		if err := cp.Commit(ctx, entry.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
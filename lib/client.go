@@ -1,73 +1,88 @@
 // Package lib provides a client library for interacting with TempDB.
 // It includes functionality for creating and managing database clients, constructing and executing queries,
 // and performing various database operations such as setting and getting values, managing sessions, and more.
+//
+// Every command has a Context variant (SetContext, GetContext, XReadContext, ...) that applies the
+// context's deadline to the underlying connection and aborts the round trip when the context is cancelled.
+// The plain variants behave like their Context counterparts called with context.Background().
 
 package lib
 
 import (
-	"bufio"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"log"
-	"net"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
 // Config holds the configuration for connecting to TempDB.
+// A URL using the tempdbs:// scheme enables TLS just like UseTLS.
 type Config struct {
-	Addr   string // Addr is the address of the TempDB server.
-	URL    string // URL is the URL of the collection.
-	UseTLS bool
+	Addr      string      // Addr is the address of the TempDB server.
+	URL       string      // URL is the URL of the collection.
+	UseTLS    bool        // UseTLS encrypts the connection, verifying the server against the system roots.
+	TLSConfig *tls.Config // TLSConfig customises TLS (CA pool, client certificates); setting it implies UseTLS.
+	Pool      PoolConfig  // Pool configures the connection pool NewClient draws from.
+	Retry     RetryPolicy // Retry controls reconnecting and resending commands after a connection drops.
+	Hooks     *Hooks      // Hooks, if set, observe disconnects and reconnects.
 }
 
 // TempDBClient represents a client connection to TempDB.
 type TempDBClient struct {
-	conn      net.Conn   // conn is the network connection to the TempDB server.
-	addr      string     // addr is the address of the TempDB server.
-	urlString string     // urlString contains the full URL of the collection.
-	mu        sync.Mutex // mu is a mutex to ensure thread-safe operations.
-	sessionId string     // sessionId stores the authentication session ID
+	conn      *connection   // conn is the framed connection to the TempDB server.
+	addr      string        // addr is the address of the TempDB server.
+	urlString string        // urlString contains the full URL of the collection.
+	mu        chan struct{} // mu serialises round trips; acquiring it honours context cancellation.
+	sessionId string        // sessionId stores the authentication session ID
+	config    Config        // config is used to re-dial and re-authenticate after a disconnect.
+	closed    bool          // closed is set once Close has closed the connection for good.
+
+	pool       *Pool     // pool is the pool the client returns to on Close, if any.
+	createdAt  time.Time // createdAt is when the connection was established.
+	returnedAt time.Time // returnedAt is when the client was last returned to its pool.
+	idle       bool      // idle is set while the client sits in its pool.
+	subscribed bool      // subscribed is set once Subscribe has installed a push handler; such a client is never pooled.
+}
+
+// dialTimeout bounds connection establishment when the caller's context has no deadline.
+const dialTimeout = 5 * time.Second
+
+// NewClient checks a client out of the pool shared by every call for the same
+// address, collection URL and TLS setting, dialing a new connection when no idle
+// one is available. The pool keeps the settings of the first Config it was
+// created for; use NewPool for connections that need different ones.
+func NewClient(config Config) (*TempDBClient, error) {
+	return NewClientContext(context.Background(), config)
 }
 
-// clientPool manages a pool of TempDBClient connections.
-type clientPool struct {
-	clients chan *TempDBClient // clients is a channel of TempDBClient pointers.
-	size    int                // size is the maximum number of clients in the pool.
+// NewClientContext is like NewClient but uses ctx for dialing and authentication.
+func NewClientContext(ctx context.Context, config Config) (*TempDBClient, error) {
+	return sharedPool(config).Get(ctx)
 }
 
-var pool *clientPool
+func createClient(ctx context.Context, config Config) (*TempDBClient, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
 
-func NewClient(config Config) (*TempDBClient, error) {
-	if pool == nil {
-		pool = &clientPool{
-			clients: make(chan *TempDBClient, 10),
-			size:    10,
-		}
-	}
-
-	select {
-	case client := <-pool.clients:
-		_, err := client.Ping()
-		if err != nil {
-			return createClient(config)
-		}
-		return client, nil
-	default:
-		return createClient(config)
-	}
-}
-
-func createClient(config Config) (*TempDBClient, error) {
-	conn, err := net.DialTimeout("tcp", config.Addr, 5*time.Second)
+	netConn, err := dial(dialCtx, config)
 	if err != nil {
 		return nil, fmt.Errorf("connection error: %w", err)
 	}
-	client := &TempDBClient{conn: conn, addr: config.Addr, urlString: config.URL}
+	conn := newConnection(netConn)
+	client := &TempDBClient{
+		conn:      conn,
+		addr:      config.Addr,
+		urlString: config.connectionString(),
+		mu:        make(chan struct{}, 1),
+		config:    config,
+		createdAt: time.Now(),
+	}
 
-	if err := client.authenticate(); err != nil {
+	if err := client.authenticate(ctx); err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("authentication error: %w", err)
 	}
@@ -75,95 +90,188 @@ func createClient(config Config) (*TempDBClient, error) {
 	return client, nil
 }
 
+// Close returns the client to the pool it was checked out of, or closes the
+// connection when the pool is full, closed or the connection is unusable, or
+// when Subscribe was called on it.
 func (c *TempDBClient) Close() {
-	if pool.size > len(pool.clients) {
-		pool.clients <- c
-	} else {
-		c.conn.Close()
+	if c.pool != nil {
+		c.pool.put(c)
+		return
 	}
+	c.closed = true
+	c.conn.Close()
 }
 
 func (c *TempDBClient) Ping() (interface{}, error) {
-	pong, err := c.sendCommand("PING")
+	return c.PingContext(context.Background())
+}
+
+// PingContext is like Ping but honours ctx.
+func (c *TempDBClient) PingContext(ctx context.Context) (interface{}, error) {
+	pong, err := c.sendCommand(ctx, "PING")
 	return pong, err
 }
 
-func (c *TempDBClient) sendCommand(command string) (interface{}, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// lock acquires exclusive use of the connection, giving up when ctx is done.
+func (c *TempDBClient) lock(ctx context.Context) error {
+	select {
+	case c.mu <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-	fullCommand := fmt.Sprintf("%s %s", c.urlString, command)
-	_, err := fmt.Fprintf(c.conn, "%s\r\n", fullCommand)
+func (c *TempDBClient) unlock() {
+	<-c.mu
+}
+
+func (c *TempDBClient) sendCommand(ctx context.Context, command string) (interface{}, error) {
+	responseData, err := c.sendCommandRaw(ctx, command)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send command: %w", err)
+		return nil, err
+	}
+	return decodeResponseData(responseData)
+}
+
+// sendCommandRaw sends command and returns the undecoded ResponseData of its reply.
+func (c *TempDBClient) sendCommandRaw(ctx context.Context, command string) (ResponseData, error) {
+	if err := c.lock(ctx); err != nil {
+		return ResponseData{}, err
 	}
+	defer c.unlock()
 
-	reader := bufio.NewReader(c.conn)
-	respBytes, err := reader.ReadBytes('\n')
+	// Reconnects made to resend the command share a single budget of attempts.
+	policy := c.config.Retry
+	attempts := policy.maxAttempts()
+	for {
+		used, err := c.ensureConnectedWithin(ctx, attempts)
+		if err != nil {
+			return ResponseData{}, err
+		}
+		attempts -= used
+
+		respBytes, err := c.conn.roundTrip(ctx, c.commandLine(command))
+		if err == nil {
+			return parseResponse(command, respBytes)
+		}
+
+		// Only a dropped connection is worth another attempt, and only when resending
+		// cannot apply the command twice. A command abandoned because ctx is done
+		// leaves the connection usable and is never resent.
+		if c.conn.Err() == nil || ctx.Err() != nil || attempts <= 0 || !policy.canResend(command) {
+			return ResponseData{}, err
+		}
+	}
+}
+
+// sendBlocking sends command, which the server holds until it can be answered or
+// its own timeout passes, and returns its reply. A blocking command cannot be
+// abandoned like others: the server could still answer it later, consuming a
+// message nobody reads. So if ctx is done first, and the reply does not follow
+// within blockingGrace of a deadline, the connection is closed instead; the
+// client then reconnects on its next command, or is discarded by its pool.
+// Blocking commands are never resent.
+func (c *TempDBClient) sendBlocking(ctx context.Context, command string) (ResponseData, error) {
+	if err := c.lock(ctx); err != nil {
+		return ResponseData{}, err
+	}
+	defer c.unlock()
+
+	if err := c.ensureConnected(ctx); err != nil {
+		return ResponseData{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return ResponseData{}, err
+	}
+	waiters, err := c.conn.send(ctx, c.commandLine(command))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return ResponseData{}, err
 	}
 
-	// Handle MSG prefix for Pub/Sub messages
-	respStr := strings.TrimSpace(string(respBytes))
-	if strings.HasPrefix(respStr, "MSG ") {
-		return strings.TrimPrefix(respStr, "MSG "), nil
+	r, ok := c.conn.awaitBlocking(ctx, waiters[0])
+	if !ok {
+		c.conn.fail(fmt.Errorf("%s abandoned: %w", commandName(command), ctx.Err()))
+		return ResponseData{}, ctx.Err()
+	}
+	if r.err != nil {
+		return ResponseData{}, r.err
+	}
+	return parseResponse(command, r.line)
+}
+
+// blockingTimeout caps timeout, where 0 means no limit, at the time left before
+// ctx's deadline, so the server gives up no later than the caller does.
+func blockingTimeout(ctx context.Context, timeout time.Duration) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return timeout
 	}
+	left := max(time.Until(deadline), time.Millisecond)
+	if timeout <= 0 || left < timeout {
+		return left
+	}
+	return timeout
+}
 
+// do builds cb and sends it, reporting any invalid argument without contacting the server.
+func (c *TempDBClient) do(ctx context.Context, cb *commandBuilder) (interface{}, error) {
+	command, err := cb.build()
+	if err != nil {
+		return nil, err
+	}
+	return c.sendCommand(ctx, command)
+}
+
+// doRaw is like do but returns the undecoded ResponseData.
+func (c *TempDBClient) doRaw(ctx context.Context, cb *commandBuilder) (ResponseData, error) {
+	command, err := cb.build()
+	if err != nil {
+		return ResponseData{}, err
+	}
+	return c.sendCommandRaw(ctx, command)
+}
+
+// doBlocking is like doRaw but sends a blocking command with sendBlocking.
+func (c *TempDBClient) doBlocking(ctx context.Context, cb *commandBuilder) (ResponseData, error) {
+	command, err := cb.build()
+	if err != nil {
+		return ResponseData{}, err
+	}
+	return c.sendBlocking(ctx, command)
+}
+
+// commandLine frames command for the wire, prefixed with the collection URL.
+func (c *TempDBClient) commandLine(command string) string {
+	fullCommand := fmt.Sprintf("%s %s", c.urlString, command)
+	return fmt.Sprintf("%s\r\n", fullCommand)
+}
+
+// parseResponse extracts the ResponseData from the reply to command. Error
+// replies are returned as *ServerError.
+func parseResponse(command string, respBytes []byte) (ResponseData, error) {
 	var response Response
 	if err := json.Unmarshal(respBytes, &response); err != nil {
-		return nil, fmt.Errorf("failed to parse reponse: %w", err)
+		return ResponseData{}, fmt.Errorf("failed to parse reponse: %w", err)
 	}
 
 	if response.Status == "error" {
-		return nil, fmt.Errorf("%s", response.Message)
+		return ResponseData{}, &ServerError{Code: response.Code, Message: response.Message, Command: commandName(command)}
 	}
 
 	var responseData ResponseData
 	if err := json.Unmarshal(response.Data, &responseData); err != nil {
-		return nil, fmt.Errorf("failed to parse response data: %w", err)
-	}
-
-	var result interface{}
-	switch responseData.Type {
-	case "String":
-		var s string
-		json.Unmarshal(responseData.Data, &s)
-		result = s
-	case "Json":
-		var j interface{}
-		json.Unmarshal(responseData.Data, &j)
-		result = j
-	case "List":
-		var l []string
-		json.Unmarshal(responseData.Data, &l)
-		result = l
-	case "Set":
-		var s []string
-		json.Unmarshal(responseData.Data, &s)
-		result = s
-	case "Batch":
-		var b map[string]string
-		json.Unmarshal(responseData.Data, &b)
-		result = b
+		return ResponseData{}, fmt.Errorf("failed to parse response data: %w", err)
 	}
-
-	return result, nil
+	return responseData, nil
 }
 
-func (c *TempDBClient) authenticate() error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	_, err := fmt.Fprintf(c.conn, "%s\n", c.urlString)
-	if err != nil {
-		return fmt.Errorf("failed to send connection stirng : %w", err)
-	}
-
-	reader := bufio.NewReader(c.conn)
-	respBytes, err := reader.ReadBytes('\n')
+// authenticate sends the connection string on a new connection and records the
+// session ID. The client must not yet be shared, or the caller must hold the lock.
+func (c *TempDBClient) authenticate(ctx context.Context) error {
+	respBytes, err := c.conn.roundTrip(ctx, fmt.Sprintf("%s\n", c.urlString))
 	if err != nil {
-		return fmt.Errorf("failed to read auth response: %w", err)
+		return fmt.Errorf("failed to authenticate: %w", err)
 	}
 
 	respStr := string(respBytes)
@@ -171,7 +279,7 @@ func (c *TempDBClient) authenticate() error {
 
 	// Parse the authentication response
 	if !strings.HasPrefix(respStr, "AUTH OK ") {
-		return fmt.Errorf("authentication failed: %s", respStr)
+		return fmt.Errorf("%w: %s", ErrAuthFailed, strings.TrimSpace(respStr))
 	}
 
 	c.sessionId = strings.TrimPrefix(strings.TrimSpace(respStr), "AUTH OK ")
@@ -180,77 +288,120 @@ func (c *TempDBClient) authenticate() error {
 }
 
 func (c *TempDBClient) Set(key, value string) error {
-	_, err := c.sendCommand(fmt.Sprintf("SET %s %s", key, value))
+	return c.SetContext(context.Background(), key, value)
+}
+
+// SetContext is like Set but honours ctx.
+func (c *TempDBClient) SetContext(ctx context.Context, key, value string) error {
+	_, err := c.do(ctx, newCommand("SET").key(key).value(value))
 	return err
 }
 
 func (c *TempDBClient) Get_All_KV() (interface{}, error) {
-	return c.sendCommand("Get_All_KV")
+	return c.Get_All_KVContext(context.Background())
+}
+
+// Get_All_KVContext is like Get_All_KV but honours ctx.
+func (c *TempDBClient) Get_All_KVContext(ctx context.Context) (interface{}, error) {
+	return c.sendCommand(ctx, "Get_All_KV")
 }
 
 func (c *TempDBClient) CLEAR_DB() (interface{}, error) {
-	return c.sendCommand("CLEAR_DB")
+	return c.CLEAR_DBContext(context.Background())
+}
+
+// CLEAR_DBContext is like CLEAR_DB but honours ctx.
+func (c *TempDBClient) CLEAR_DBContext(ctx context.Context) (interface{}, error) {
+	return c.sendCommand(ctx, "CLEAR_DB")
 }
 
 func (c *TempDBClient) ViewLogs() (interface{}, error) {
-	return c.sendCommand("VIEW_LOGS")
+	return c.ViewLogsContext(context.Background())
+}
+
+// ViewLogsContext is like ViewLogs but honours ctx.
+func (c *TempDBClient) ViewLogsContext(ctx context.Context) (interface{}, error) {
+	return c.sendCommand(ctx, "VIEW_LOGS")
 }
 
 func (c *TempDBClient) Get(key string) (string, error) {
-	result, err := c.sendCommand(fmt.Sprintf("GET_KEY %s", key))
+	return c.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get but honours ctx.
+func (c *TempDBClient) GetContext(ctx context.Context, key string) (string, error) {
+	result, err := c.do(ctx, newCommand("GET_KEY").key(key))
 	if err != nil {
 		return "", err
 	}
 
 	// Format the response
-	formatted, err := formatResponse(result)
-	if err != nil {
-		return "", err
-	}
-	return formatted, nil
+	return formatResponse(result)
 }
 
 func (c *TempDBClient) SetEx(key string, seconds int, value interface{}) (interface{}, error) {
-	jsonValue, err := json.Marshal(value)
-	if err != nil {
-		return "", err
-	}
-	return c.sendCommand(fmt.Sprintf("SETEX %s %d %s", key, seconds, jsonValue))
+	return c.SetExContext(context.Background(), key, seconds, value)
+}
+
+// SetExContext is like SetEx but honours ctx.
+func (c *TempDBClient) SetExContext(ctx context.Context, key string, seconds int, value interface{}) (interface{}, error) {
+	return c.do(ctx, newCommand("SETEX").key(key).int(seconds).json(value))
 }
 
 func (c *TempDBClient) Delete(key string) (interface{}, error) {
-	return c.sendCommand(fmt.Sprintf("DELETE_KEY %s", key))
+	return c.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext is like Delete but honours ctx.
+func (c *TempDBClient) DeleteContext(ctx context.Context, key string) (interface{}, error) {
+	return c.do(ctx, newCommand("DELETE_KEY").key(key))
 }
 
 func (c *TempDBClient) Store(key string, value interface{}) (interface{}, error) {
-	jsonValue, err := json.Marshal(value)
-	if err != nil {
-		return "", err
-	}
-	return c.sendCommand(fmt.Sprintf("STORE %s %s", key, string(jsonValue)))
+	return c.StoreContext(context.Background(), key, value)
+}
+
+// StoreContext is like Store but honours ctx.
+func (c *TempDBClient) StoreContext(ctx context.Context, key string, value interface{}) (interface{}, error) {
+	return c.do(ctx, newCommand("STORE").key(key).json(value))
 }
 
 // InsertDoc inserts a new document into the collection
 func (c *TempDBClient) InsertDoc(document interface{}) (string, error) {
-	jsonValue, err := json.Marshal(document)
-	if err != nil {
-		return "", err
-	}
-	result, err := c.sendCommand(fmt.Sprintf("INSERT_DOC %s", string(jsonValue)))
+	return c.InsertDocContext(context.Background(), document)
+}
+
+// InsertDocContext is like InsertDoc but honours ctx.
+func (c *TempDBClient) InsertDocContext(ctx context.Context, document interface{}) (string, error) {
+	result, err := c.do(ctx, newCommand("INSERT_DOC").json(document))
 	if err != nil {
 		return "", err
 	}
+	return documentID(result)
+}
+
+// documentID converts an INSERT_DOC result into the new document's ID.
+func documentID(result interface{}) (string, error) {
 	// Result will be the document ID
 	return fmt.Sprint(result), nil
 }
 
 // GetDoc retrieves a document by its ID
 func (c *TempDBClient) GetDoc(docID string) (map[string]interface{}, error) {
-	result, err := c.sendCommand(fmt.Sprintf("GET_DOC %s", docID))
+	return c.GetDocContext(context.Background(), docID)
+}
+
+// GetDocContext is like GetDoc but honours ctx.
+func (c *TempDBClient) GetDocContext(ctx context.Context, docID string) (map[string]interface{}, error) {
+	result, err := c.do(ctx, newCommand("GET_DOC").key(docID))
 	if err != nil {
 		return nil, err
 	}
+	return document(result)
+}
 
+// document converts a single-document result into its fields.
+func document(result interface{}) (map[string]interface{}, error) {
 	doc, ok := result.(map[string]interface{})
 	if !ok {
 		return nil, fmt.Errorf("unexpected response format")
@@ -260,7 +411,12 @@ func (c *TempDBClient) GetDoc(docID string) (map[string]interface{}, error) {
 
 // GetAllDocs retrieves all documents in the collection
 func (c *TempDBClient) GetAllDocs() ([]map[string]interface{}, error) {
-	result, err := c.sendCommand("GET_ALL_DOCS")
+	return c.GetAllDocsContext(context.Background())
+}
+
+// GetAllDocsContext is like GetAllDocs but honours ctx.
+func (c *TempDBClient) GetAllDocsContext(ctx context.Context) ([]map[string]interface{}, error) {
+	result, err := c.sendCommand(ctx, "GET_ALL_DOCS")
 	if err != nil {
 		return nil, err
 	}
@@ -289,37 +445,37 @@ func (c *TempDBClient) GetAllDocs() ([]map[string]interface{}, error) {
 
 // UpdateDoc updates a document by its ID
 func (c *TempDBClient) UpdateDoc(docID string, update interface{}) (map[string]interface{}, error) {
-	jsonValue, err := json.Marshal(update)
-	if err != nil {
-		return nil, err
-	}
+	return c.UpdateDocContext(context.Background(), docID, update)
+}
 
-	result, err := c.sendCommand(fmt.Sprintf("UPDATE_DOC %s %s", docID, string(jsonValue)))
+// UpdateDocContext is like UpdateDoc but honours ctx.
+func (c *TempDBClient) UpdateDocContext(ctx context.Context, docID string, update interface{}) (map[string]interface{}, error) {
+	result, err := c.do(ctx, newCommand("UPDATE_DOC").key(docID).json(update))
 	if err != nil {
 		return nil, err
 	}
-
-	doc, ok := result.(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("unexpected response format")
-	}
-	return doc, nil
+	return document(result)
 }
 
 // DeleteDoc deletes a document by its ID
 func (c *TempDBClient) DeleteDoc(docID string) error {
-	_, err := c.sendCommand(fmt.Sprintf("DELETE_DOC %s", docID))
+	return c.DeleteDocContext(context.Background(), docID)
+}
+
+// DeleteDocContext is like DeleteDoc but honours ctx.
+func (c *TempDBClient) DeleteDocContext(ctx context.Context, docID string) error {
+	_, err := c.do(ctx, newCommand("DELETE_DOC").key(docID))
 	return err
 }
 
 // QueryDocs queries documents using a filter
 func (c *TempDBClient) QueryDocs(filter interface{}) ([]map[string]interface{}, error) {
-	jsonValue, err := json.Marshal(filter)
-	if err != nil {
-		return nil, err
-	}
+	return c.QueryDocsContext(context.Background(), filter)
+}
 
-	result, err := c.sendCommand(fmt.Sprintf("QUERY_DOCS %s", string(jsonValue)))
+// QueryDocsContext is like QueryDocs but honours ctx.
+func (c *TempDBClient) QueryDocsContext(ctx context.Context, filter interface{}) ([]map[string]interface{}, error) {
+	result, err := c.do(ctx, newCommand("QUERY_DOCS").json(filter))
 	if err != nil {
 		return nil, err
 	}
@@ -347,53 +503,69 @@ func (c *TempDBClient) QueryDocs(filter interface{}) ([]map[string]interface{},
 }
 
 func (c *TempDBClient) Batch(entries map[string]interface{}) (interface{}, error) {
-	jsonValue, err := json.Marshal(entries)
-	if err != nil {
-		return "", err
-	}
-	return c.sendCommand(fmt.Sprintf("Batch %s", string(jsonValue)))
+	return c.BatchContext(context.Background(), entries)
+}
+
+// BatchContext is like Batch but honours ctx.
+func (c *TempDBClient) BatchContext(ctx context.Context, entries map[string]interface{}) (interface{}, error) {
+	return c.do(ctx, newCommand("Batch").json(entries))
 }
 
 func (c *TempDBClient) GetFieldByKey(key, field string) (interface{}, error) {
-	return c.sendCommand(fmt.Sprintf("GET_FIELD %s /%s", key, field))
+	return c.GetFieldByKeyContext(context.Background(), key, field)
+}
+
+// GetFieldByKeyContext is like GetFieldByKey but honours ctx.
+func (c *TempDBClient) GetFieldByKeyContext(ctx context.Context, key, field string) (interface{}, error) {
+	return c.do(ctx, newCommand("GET_FIELD").key(key).key("/"+field))
 }
 
-// Subscribe subscribes to a Pub/Sub channel and calls the handler for each message
+// Subscribe subscribes to a Pub/Sub channel and calls the handler for each message.
+// The subscription shares the client's connection and is not restored if that
+// connection drops; NewPubSub gives subscriptions a connection of their own that
+// resubscribes after reconnecting.
 func (c *TempDBClient) Subscribe(channel string, handler func(message string)) error {
-	_, err := c.sendCommand(fmt.Sprintf("SUBSCRIBE %s", channel))
-	if err != nil {
-		return err
-	}
+	return c.SubscribeContext(context.Background(), channel, handler)
+}
 
-	go func() {
-		reader := bufio.NewReader(c.conn)
-		for {
-			msgBytes, err := reader.ReadBytes('\n')
-			if err != nil {
-				log.Printf("Error reading subscription message: %v", err)
-				return
-			}
-			msg := strings.TrimSpace(string(msgBytes))
-			if strings.HasPrefix(msg, "MSG ") {
-				handler(strings.TrimPrefix(msg, "MSG "))
-			}
-		}
-	}()
-	return nil
+// SubscribeContext is like Subscribe but honours ctx while issuing the SUBSCRIBE command.
+// The handler keeps receiving messages after ctx is done.
+func (c *TempDBClient) SubscribeContext(ctx context.Context, channel string, handler func(message string)) error {
+	// Install the handler first so messages pushed straight after the reply are not missed.
+	c.subscribed = true
+	c.conn.setPushHandler(handler)
+
+	_, err := c.do(ctx, newCommand("SUBSCRIBE").key(channel))
+	return err
 }
 
 // Unsubscribe unsubscribes from a Pub/Sub channel
 func (c *TempDBClient) Unsubscribe(channel string) error {
-	_, err := c.sendCommand(fmt.Sprintf("UNSUBSCRIBE %s", channel))
+	return c.UnsubscribeContext(context.Background(), channel)
+}
+
+// UnsubscribeContext is like Unsubscribe but honours ctx.
+func (c *TempDBClient) UnsubscribeContext(ctx context.Context, channel string) error {
+	_, err := c.do(ctx, newCommand("UNSUBSCRIBE").key(channel))
 	return err
 }
 
 // Publish publishes a message to a Pub/Sub channel
 func (c *TempDBClient) Publish(channel, message string) (int, error) {
-	result, err := c.sendCommand(fmt.Sprintf("PUBLISH %s %s", channel, message))
+	return c.PublishContext(context.Background(), channel, message)
+}
+
+// PublishContext is like Publish but honours ctx.
+func (c *TempDBClient) PublishContext(ctx context.Context, channel, message string) (int, error) {
+	result, err := c.do(ctx, newCommand("PUBLISH").key(channel).value(message))
 	if err != nil {
 		return 0, err
 	}
+	return publishCount(result)
+}
+
+// publishCount converts a PUBLISH result into the number of receiving subscribers.
+func publishCount(result interface{}) (int, error) {
 	if countStr, ok := result.(string); ok {
 		if strings.HasPrefix(countStr, "SENT_TO_") {
 			count, _ := strconv.Atoi(strings.TrimPrefix(countStr, "SENT_TO_"))
@@ -405,14 +577,20 @@ func (c *TempDBClient) Publish(channel, message string) (int, error) {
 
 // XAdd adds an entry to an event stream
 func (c *TempDBClient) XAdd(streamKey string, data interface{}) (string, error) {
-	jsonValue, err := json.Marshal(data)
-	if err != nil {
-		return "", err
-	}
-	result, err := c.sendCommand(fmt.Sprintf("XADD %s %s", streamKey, string(jsonValue)))
+	return c.XAddContext(context.Background(), streamKey, data)
+}
+
+// XAddContext is like XAdd but honours ctx.
+func (c *TempDBClient) XAddContext(ctx context.Context, streamKey string, data interface{}) (string, error) {
+	result, err := c.do(ctx, newCommand("XADD").key(streamKey).json(data))
 	if err != nil {
 		return "", err
 	}
+	return streamID(result)
+}
+
+// streamID converts an XADD result into the new entry's ID.
+func streamID(result interface{}) (string, error) {
 	if id, ok := result.(string); ok {
 		return id, nil
 	}
@@ -421,10 +599,20 @@ func (c *TempDBClient) XAdd(streamKey string, data interface{}) (string, error)
 
 // XRead reads entries from an event stream
 func (c *TempDBClient) XRead(streamKey, startID string, count int) ([]map[string]interface{}, error) {
-	result, err := c.sendCommand(fmt.Sprintf("XREAD %s %s %d", streamKey, startID, count))
+	return c.XReadContext(context.Background(), streamKey, startID, count)
+}
+
+// XReadContext is like XRead but honours ctx.
+func (c *TempDBClient) XReadContext(ctx context.Context, streamKey, startID string, count int) ([]map[string]interface{}, error) {
+	result, err := c.do(ctx, newCommand("XREAD").key(streamKey).key(startID).int(count))
 	if err != nil {
 		return nil, err
 	}
+	return streamEntries(result)
+}
+
+// streamEntries converts an XREAD result into its entries.
+func streamEntries(result interface{}) ([]map[string]interface{}, error) {
 	entries, ok := result.([]interface{})
 	if !ok {
 		return nil, fmt.Errorf("unexpected response format")
@@ -442,17 +630,24 @@ func (c *TempDBClient) XRead(streamKey, startID string, count int) ([]map[string
 
 // Enqueue adds a message to a queue
 func (c *TempDBClient) Enqueue(queueKey string, message interface{}) error {
-	jsonValue, err := json.Marshal(message)
-	if err != nil {
-		return err
-	}
-	_, err = c.sendCommand(fmt.Sprintf("ENQUEUE %s %s", queueKey, string(jsonValue)))
+	return c.EnqueueContext(context.Background(), queueKey, message)
+}
+
+// EnqueueContext is like Enqueue but honours ctx.
+func (c *TempDBClient) EnqueueContext(ctx context.Context, queueKey string, message interface{}) error {
+	_, err := c.do(ctx, newCommand("ENQUEUE").key(queueKey).json(message))
 	return err
 }
 
-// Dequeue removes and returns a message from a queue
+// Dequeue removes and returns a message from a queue. Messages with a higher
+// priority are returned first; see EnqueuePriority.
 func (c *TempDBClient) Dequeue(queueKey string) (interface{}, error) {
-	return c.sendCommand(fmt.Sprintf("DEQUEUE %s", queueKey))
+	return c.DequeueContext(context.Background(), queueKey)
+}
+
+// DequeueContext is like Dequeue but honours ctx.
+func (c *TempDBClient) DequeueContext(ctx context.Context, queueKey string) (interface{}, error) {
+	return c.do(ctx, newCommand("DEQUEUE").key(queueKey))
 }
 
 // PubSubChannels retrieves all active Pub/Sub channels in the database.
@@ -462,7 +657,12 @@ func (c *TempDBClient) Dequeue(queueKey string) (interface{}, error) {
 //   - Input: None (uses the client's current database context).
 //   - Output: A slice of strings representing channel names.
 func (c *TempDBClient) PubSubChannels() (interface{}, error) {
-	result, err := c.sendCommand("CHANS")
+	return c.PubSubChannelsContext(context.Background())
+}
+
+// PubSubChannelsContext is like PubSubChannels but honours ctx.
+func (c *TempDBClient) PubSubChannelsContext(ctx context.Context) (interface{}, error) {
+	result, err := c.sendCommand(ctx, "CHANS")
 	if err != nil {
 		return nil, err
 	}
@@ -477,7 +677,12 @@ func (c *TempDBClient) PubSubChannels() (interface{}, error) {
 //   - Input: None (uses the client's current database context).
 //   - Output: A slice of strings representing stream keys.
 func (c *TempDBClient) XList() (interface{}, error) {
-	result, err := c.sendCommand("XLIST")
+	return c.XListContext(context.Background())
+}
+
+// XListContext is like XList but honours ctx.
+func (c *TempDBClient) XListContext(ctx context.Context) (interface{}, error) {
+	result, err := c.sendCommand(ctx, "XLIST")
 	if err != nil {
 		return nil, err
 	}
@@ -492,7 +697,12 @@ func (c *TempDBClient) XList() (interface{}, error) {
 //   - Input: None (uses the client's current database context).
 //   - Output: A slice of strings representing queue keys.
 func (c *TempDBClient) QList() (interface{}, error) {
-	result, err := c.sendCommand("QLIST")
+	return c.QListContext(context.Background())
+}
+
+// QListContext is like QList but honours ctx.
+func (c *TempDBClient) QListContext(ctx context.Context) (interface{}, error) {
+	result, err := c.sendCommand(ctx, "QLIST")
 	if err != nil {
 		return nil, err
 	}
@@ -507,7 +717,12 @@ func (c *TempDBClient) QList() (interface{}, error) {
 //   - Input: channel (string) - The name of the channel to check.
 //   - Output: An integer representing the number of subscribers.
 func (c *TempDBClient) PubSubNumSub(channel string) (interface{}, error) {
-	result, err := c.sendCommand(fmt.Sprintf("CHANS_SUBS %s", channel))
+	return c.PubSubNumSubContext(context.Background(), channel)
+}
+
+// PubSubNumSubContext is like PubSubNumSub but honours ctx.
+func (c *TempDBClient) PubSubNumSubContext(ctx context.Context, channel string) (interface{}, error) {
+	result, err := c.do(ctx, newCommand("CHANS_SUBS").key(channel))
 	if err != nil {
 		return 0, err
 	}
@@ -522,7 +737,12 @@ func (c *TempDBClient) PubSubNumSub(channel string) (interface{}, error) {
 //   - Input: streamKey (string) - The key of the stream to delete.
 //   - Output: None (returns nil on success).
 func (c *TempDBClient) XDel(streamKey string) error {
-	result, err := c.sendCommand(fmt.Sprintf("XDEL %s", streamKey))
+	return c.XDelContext(context.Background(), streamKey)
+}
+
+// XDelContext is like XDel but honours ctx.
+func (c *TempDBClient) XDelContext(ctx context.Context, streamKey string) error {
+	result, err := c.do(ctx, newCommand("XDEL").key(streamKey))
 	if err != nil {
 		return err
 	}
@@ -538,8 +758,14 @@ func (c *TempDBClient) XDel(streamKey string) error {
 //   - Command: QPEEK <queue_key>
 //   - Input: queueKey (string) - The key of the queue to peek into.
 //   - Output: An interface{} containing the next message (typically a map[string]interface{} for JSON data).
+//   - Scheduled messages that are not yet due are skipped; see QPeekScheduled.
 func (c *TempDBClient) QPeek(queueKey string) (interface{}, error) {
-	result, err := c.sendCommand(fmt.Sprintf("QPEEK %s", queueKey))
+	return c.QPeekContext(context.Background(), queueKey)
+}
+
+// QPeekContext is like QPeek but honours ctx.
+func (c *TempDBClient) QPeekContext(ctx context.Context, queueKey string) (interface{}, error) {
+	result, err := c.do(ctx, newCommand("QPEEK").key(queueKey))
 	if err != nil {
 		return nil, err
 	}
@@ -552,8 +778,14 @@ func (c *TempDBClient) QPeek(queueKey string) (interface{}, error) {
 //   - Command: QLEN <queue_key>
 //   - Input: queueKey (string) - The key of the queue to check.
 //   - Output: An integer representing the number of messages in the queue.
+//   - Scheduled messages that are not yet due are not counted; see QCounts.
 func (c *TempDBClient) QLen(queueKey string) (interface{}, error) {
-	result, err := c.sendCommand(fmt.Sprintf("QLEN %s", queueKey))
+	return c.QLenContext(context.Background(), queueKey)
+}
+
+// QLenContext is like QLen but honours ctx.
+func (c *TempDBClient) QLenContext(ctx context.Context, queueKey string) (interface{}, error) {
+	result, err := c.do(ctx, newCommand("QLEN").key(queueKey))
 	if err != nil {
 		return 0, err
 	}
@@ -568,7 +800,12 @@ func (c *TempDBClient) QLen(queueKey string) (interface{}, error) {
 //   - Input: None (uses the client's current database context).
 //   - Output: A map[string]int where keys are channel names and values are subscriber counts.
 func (c *TempDBClient) PubSubAll() (interface{}, error) {
-	result, err := c.sendCommand("PUBSUB_ALL")
+	return c.PubSubAllContext(context.Background())
+}
+
+// PubSubAllContext is like PubSubAll but honours ctx.
+func (c *TempDBClient) PubSubAllContext(ctx context.Context) (interface{}, error) {
+	result, err := c.sendCommand(ctx, "PUBSUB_ALL")
 	if err != nil {
 		return nil, err
 	}
@@ -583,7 +820,12 @@ func (c *TempDBClient) PubSubAll() (interface{}, error) {
 //   - Input: None (uses the client's current database context).
 //   - Output: A map[string][]interface{} where keys are queue names and values are slices of messages (typically JSON objects).
 func (c *TempDBClient) QueuesAll() (interface{}, error) {
-	result, err := c.sendCommand("QUEUES_ALL")
+	return c.QueuesAllContext(context.Background())
+}
+
+// QueuesAllContext is like QueuesAll but honours ctx.
+func (c *TempDBClient) QueuesAllContext(ctx context.Context) (interface{}, error) {
+	result, err := c.sendCommand(ctx, "QUEUES_ALL")
 	if err != nil {
 		return nil, err
 	}
@@ -596,7 +838,12 @@ func (c *TempDBClient) QueuesAll() (interface{}, error) {
 //   - Purpose: Retrieves a map of all event streams and their current events.
 //   - Command: STREAMS_ALL
 func (c *TempDBClient) StreamsAll() (interface{}, error) {
-	result, err := c.sendCommand("STREAMS_ALL")
+	return c.StreamsAllContext(context.Background())
+}
+
+// StreamsAllContext is like StreamsAll but honours ctx.
+func (c *TempDBClient) StreamsAllContext(ctx context.Context) (interface{}, error) {
+	result, err := c.sendCommand(ctx, "STREAMS_ALL")
 	if err != nil {
 		return nil, err
 	}
@@ -606,22 +853,22 @@ func (c *TempDBClient) StreamsAll() (interface{}, error) {
 
 // VSet stores a vector with optional metadata in TempDB
 func (c *TempDBClient) VSet(key string, vector []float32, metadata interface{}) (interface{}, error) {
-	vecJSON, err := json.Marshal(vector)
-	if err != nil {
-		return "", err
-	}
-
-	metadataJson, err := json.Marshal(metadata)
-	if err != nil {
-		return "", err
-	}
+	return c.VSetContext(context.Background(), key, vector, metadata)
+}
 
-	return c.sendCommand(fmt.Sprintf("VSet %s %s %s", key, string(vecJSON), string(metadataJson)))
+// VSetContext is like VSet but honours ctx.
+func (c *TempDBClient) VSetContext(ctx context.Context, key string, vector []float32, metadata interface{}) (interface{}, error) {
+	return c.do(ctx, newCommand("VSet").key(key).json(vector).json(metadata))
 }
 
 // VGet retrieves a vector and its metadata from TempDB
 func (c *TempDBClient) VGet(key string) (interface{}, error) {
-	result, err := c.sendCommand(fmt.Sprintf("VGet %s", key))
+	return c.VGetContext(context.Background(), key)
+}
+
+// VGetContext is like VGet but honours ctx.
+func (c *TempDBClient) VGetContext(ctx context.Context, key string) (interface{}, error) {
+	result, err := c.do(ctx, newCommand("VGet").key(key))
 	if err != nil {
 		return nil, err
 	}
@@ -636,12 +883,10 @@ func (c *TempDBClient) VGet(key string) (interface{}, error) {
 
 // VSearch searches for the k most similar vectors in TempDB
 func (c *TempDBClient) VSearch(queryVector []float32, k int) (interface{}, error) {
+	return c.VSearchContext(context.Background(), queryVector, k)
+}
 
-	queryJSON, err := json.Marshal(queryVector)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal query vector: %v", err)
-	}
-
-	return c.sendCommand(fmt.Sprintf("VSearch %s %s", string(queryJSON), fmt.Sprint(k)))
-
+// VSearchContext is like VSearch but honours ctx.
+func (c *TempDBClient) VSearchContext(ctx context.Context, queryVector []float32, k int) (interface{}, error) {
+	return c.do(ctx, newCommand("VSearch").json(queryVector).int(k))
 }
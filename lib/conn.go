@@ -0,0 +1,293 @@
+package lib
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pushBuffer is how many pushed messages may queue before the reader waits for
+// the push handler to catch up. Replies arriving meanwhile wait with it.
+const pushBuffer = 256
+
+// blockingGrace is how long a blocking command whose context has expired still
+// waits for its reply, which the server sends by the same deadline.
+const blockingGrace = 500 * time.Millisecond
+
+// reply is a single response line read from the server, or the error that
+// prevented it from being read.
+type reply struct {
+	line []byte
+	err  error
+}
+
+// connection frames the TempDB line protocol over a net.Conn. It owns the only
+// buffered reader and writer for the life of the connection: one goroutine reads
+// every line, handing pushed Pub/Sub messages to the push handler and every other
+// line, in order, to the command that is waiting for it. Because replies are
+// matched to commands by position, a command abandoned by its caller still
+// consumes its reply and the connection stays in step.
+type connection struct {
+	netConn net.Conn
+	br      *bufio.Reader
+	bw      *bufio.Writer
+
+	wmu sync.Mutex // wmu serialises writes together with registering their reply waiters.
+
+	mu      sync.Mutex
+	waiters []chan reply // waiters holds one channel per command awaiting a reply, oldest first.
+	err     error        // err is set once the connection has failed or been closed.
+	pushes  chan string  // pushes is non-nil once pushed messages are being delivered.
+	onPush  func(payload string)
+	stopped bool          // stopped is set once the reader has exited and will deliver nothing more.
+	closing chan struct{} // closing is closed by fail, releasing a reader blocked on a full push channel.
+	done    chan struct{}
+}
+
+func newConnection(netConn net.Conn) *connection {
+	cn := &connection{
+		netConn: netConn,
+		br:      bufio.NewReader(netConn),
+		bw:      bufio.NewWriter(netConn),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go cn.readLoop()
+	return cn
+}
+
+// readLoop reads lines until the connection fails, routing each one as a push or a reply.
+func (cn *connection) readLoop() {
+	defer func() {
+		cn.mu.Lock()
+		if cn.pushes != nil {
+			close(cn.pushes)
+		}
+		cn.stopped = true
+		cn.mu.Unlock()
+		close(cn.done)
+	}()
+
+	for {
+		line, err := cn.br.ReadBytes('\n')
+		if err != nil {
+			cn.fail(fmt.Errorf("failed to read response: %w", err))
+			return
+		}
+
+		if push, ok := pushMessage(line); ok {
+			cn.mu.Lock()
+			pushes := cn.pushes
+			cn.mu.Unlock()
+			if pushes != nil {
+				select {
+				case pushes <- push:
+				case <-cn.closing:
+					return
+				}
+			}
+			continue
+		}
+
+		cn.mu.Lock()
+		if len(cn.waiters) == 0 {
+			cn.mu.Unlock()
+			cn.fail(fmt.Errorf("unexpected response: %s", strings.TrimSpace(string(line))))
+			return
+		}
+		waiter := cn.waiters[0]
+		cn.waiters = cn.waiters[1:]
+		cn.mu.Unlock()
+
+		waiter <- reply{line: line}
+	}
+}
+
+// pushMessage reports whether line is a pushed Pub/Sub message, either
+// "MSG <channel> <message>" for a channel subscription or
+// "PMSG <pattern> <channel> <message>" for a pattern subscription, and returns
+// it without its line terminator.
+func pushMessage(line []byte) (string, bool) {
+	msg := strings.TrimSpace(string(line))
+	if !strings.HasPrefix(msg, "MSG ") && !strings.HasPrefix(msg, "PMSG ") {
+		return "", false
+	}
+	return msg, true
+}
+
+// pushChannel returns the channel on which every message pushed on this
+// connection is delivered, in arrival order. The channel is closed when
+// the connection fails. Pushes that arrive before the first call are discarded,
+// and every call returns the same channel, so there must be a single consumer.
+func (cn *connection) pushChannel() <-chan string {
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+
+	if cn.pushes == nil {
+		cn.pushes = make(chan string, pushBuffer)
+		if cn.stopped {
+			close(cn.pushes)
+		}
+	}
+	return cn.pushes
+}
+
+// setPushHandler arranges for handler to be called, on its own goroutine and in
+// arrival order, with the text following "MSG " of every channel message pushed
+// on this connection. It replaces any previous handler.
+func (cn *connection) setPushHandler(handler func(payload string)) {
+	cn.mu.Lock()
+	installed := cn.onPush != nil
+	cn.onPush = handler
+	cn.mu.Unlock()
+	if installed {
+		return
+	}
+
+	pushes := cn.pushChannel()
+	go func() {
+		for push := range pushes {
+			payload, ok := strings.CutPrefix(push, "MSG ")
+			if !ok {
+				continue
+			}
+			cn.mu.Lock()
+			handler := cn.onPush
+			cn.mu.Unlock()
+			handler(payload)
+		}
+	}()
+}
+
+// send writes lines to the server and returns one channel per line on which its
+// reply will be delivered. The context's deadline bounds the write; a failed
+// write leaves the stream in an unknown state and so closes the connection.
+func (cn *connection) send(ctx context.Context, lines ...string) ([]chan reply, error) {
+	cn.wmu.Lock()
+	defer cn.wmu.Unlock()
+
+	cn.mu.Lock()
+	if cn.err != nil {
+		err := cn.err
+		cn.mu.Unlock()
+		return nil, err
+	}
+	waiters := make([]chan reply, len(lines))
+	for i := range lines {
+		waiters[i] = make(chan reply, 1)
+	}
+	cn.waiters = append(cn.waiters, waiters...)
+	cn.mu.Unlock()
+
+	deadline, _ := ctx.Deadline()
+	cn.netConn.SetWriteDeadline(deadline)
+	defer cn.netConn.SetWriteDeadline(time.Time{})
+
+	for _, line := range lines {
+		if _, err := cn.bw.WriteString(line); err != nil {
+			return nil, cn.writeFailed(ctx, err)
+		}
+	}
+	if err := cn.bw.Flush(); err != nil {
+		return nil, cn.writeFailed(ctx, err)
+	}
+	return waiters, nil
+}
+
+// writeFailed fails the connection after a write error and returns the error to
+// report: context.DeadlineExceeded if ctx's deadline cut the write short, and
+// otherwise the error recorded by fail, which matches ErrConnectionClosed.
+func (cn *connection) writeFailed(ctx context.Context, err error) error {
+	cn.fail(fmt.Errorf("failed to send command: %w", err))
+	var netErr net.Error
+	if _, ok := ctx.Deadline(); ok && errors.As(err, &netErr) && netErr.Timeout() {
+		return context.DeadlineExceeded
+	}
+	return cn.Err()
+}
+
+// await waits for the reply delivered on waiter. If ctx is done first the reply is
+// left to be discarded when it arrives.
+func (cn *connection) await(ctx context.Context, waiter chan reply) ([]byte, error) {
+	select {
+	case r := <-waiter:
+		return r.line, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// awaitBlocking waits for the reply to a blocking command on waiter and reports
+// whether it arrived. When ctx's deadline passes it waits blockingGrace longer,
+// since the server was told to answer by the same deadline.
+func (cn *connection) awaitBlocking(ctx context.Context, waiter chan reply) (reply, bool) {
+	select {
+	case r := <-waiter:
+		return r, true
+	case <-ctx.Done():
+	}
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return reply{}, false
+	}
+	timer := time.NewTimer(blockingGrace)
+	defer timer.Stop()
+	select {
+	case r := <-waiter:
+		return r, true
+	case <-timer.C:
+		return reply{}, false
+	}
+}
+
+// roundTrip writes line and waits for its reply.
+func (cn *connection) roundTrip(ctx context.Context, line string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	waiters, err := cn.send(ctx, line)
+	if err != nil {
+		return nil, err
+	}
+	return cn.await(ctx, waiters[0])
+}
+
+// fail records err as the reason the connection is unusable, closes it and
+// wakes every command still waiting for a reply. The recorded error always
+// matches ErrConnectionClosed.
+func (cn *connection) fail(err error) {
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+
+	if cn.err != nil {
+		return
+	}
+	if !errors.Is(err, ErrConnectionClosed) {
+		err = fmt.Errorf("%w: %w", ErrConnectionClosed, err)
+	}
+	cn.err = err
+	close(cn.closing)
+	cn.netConn.Close()
+	for _, waiter := range cn.waiters {
+		waiter <- reply{err: err}
+	}
+	cn.waiters = nil
+}
+
+// Err returns the reason the connection can no longer be used, or nil.
+func (cn *connection) Err() error {
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+	return cn.err
+}
+
+// Close closes the connection and waits for its reader to stop.
+func (cn *connection) Close() error {
+	cn.fail(ErrConnectionClosed)
+	<-cn.done
+	return nil
+}
@@ -0,0 +1,75 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// keyOf returns the key argument of a command such as "GET_KEY a".
+func keyOf(command string) string {
+	fields := strings.Fields(command)
+	if len(fields) < 2 {
+		return ""
+	}
+	return fields[1]
+}
+
+func TestAbandonedReplyKeepsConnectionInStep(t *testing.T) {
+	s := newFakeServer(t, func(fc *fakeConn, command string) {
+		key := keyOf(command)
+		if key == "slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		fc.reply(TypeString, key)
+	})
+	client, err := NewClient(s.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := GetAsContext[string](ctx, client, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("abandoned Get returned %v, want context.DeadlineExceeded", err)
+	}
+
+	// The late reply to "slow" must be discarded, not handed to the next command.
+	got, err := GetAs[string](client, "fast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "fast" {
+		t.Fatalf("Get(fast) = %q, want %q", got, "fast")
+	}
+}
+
+func TestCloseFailsPendingCommands(t *testing.T) {
+	s := newFakeServer(t, func(fc *fakeConn, command string) {
+		// Never reply.
+	})
+	client, err := createClient(context.Background(), s.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := client.Ping()
+		errc <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	client.Close()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, ErrConnectionClosed) {
+			t.Fatalf("Ping returned %v, want ErrConnectionClosed", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Ping still waiting after Close")
+	}
+}
@@ -0,0 +1,145 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DeadLetterPolicy sends messages that keep failing on a queue to a dead-letter
+// queue instead of redelivering them forever. A delivery fails when it is
+// rejected with Reject or Nack, or when its lease expires without an Ack.
+type DeadLetterPolicy struct {
+	DeadLetterQueue string // DeadLetterQueue is the key failed messages are moved to.
+	MaxDeliveries   int    // MaxDeliveries is how many deliveries may fail before the message is moved.
+}
+
+// DeadLetter is a message moved to a dead-letter queue, with the record of its failures.
+type DeadLetter struct {
+	ID             string    // ID identifies the message within the dead-letter queue.
+	Queue          string    // Queue is the queue the message was originally enqueued on.
+	Payload        []byte    // Payload is the message as JSON.
+	LastError      string    // LastError is the reason given when the last delivery was rejected.
+	DeliveryCount  int       // DeliveryCount is how many times the message was delivered.
+	EnqueuedAt     time.Time // EnqueuedAt is when the message was first enqueued.
+	LastDelivered  time.Time // LastDelivered is when the message was last delivered.
+	DeadLetteredAt time.Time // DeadLetteredAt is when the message was moved to the dead-letter queue.
+}
+
+// deadLetter is the wire form of a DeadLetter. Times are Unix milliseconds.
+type deadLetter struct {
+	ID             string          `json:"id"`
+	Queue          string          `json:"queue"`
+	Message        json.RawMessage `json:"message"`
+	LastError      string          `json:"last_error"`
+	DeliveryCount  int             `json:"delivery_count"`
+	EnqueuedAt     int64           `json:"enqueued_at"`
+	LastDelivered  int64           `json:"last_delivered_at"`
+	DeadLetteredAt int64           `json:"dead_lettered_at"`
+}
+
+// Decode unmarshals the message into v.
+func (d *DeadLetter) Decode(v interface{}) error {
+	if err := json.Unmarshal(d.Payload, v); err != nil {
+		return fmt.Errorf("failed to decode dead letter %s into %T: %w", d.ID, v, err)
+	}
+	return nil
+}
+
+// SetDeadLetterPolicy configures the dead-letter queue for queueKey. The policy
+// is stored by the server, so it applies to every consumer of the queue.
+func (c *TempDBClient) SetDeadLetterPolicy(queueKey string, policy DeadLetterPolicy) error {
+	return c.SetDeadLetterPolicyContext(context.Background(), queueKey, policy)
+}
+
+// SetDeadLetterPolicyContext is like SetDeadLetterPolicy but honours ctx.
+func (c *TempDBClient) SetDeadLetterPolicyContext(ctx context.Context, queueKey string, policy DeadLetterPolicy) error {
+	if policy.MaxDeliveries <= 0 {
+		return &ArgumentError{Command: "QDLQ", Arg: fmt.Sprint(policy.MaxDeliveries), Reason: "MaxDeliveries must be positive"}
+	}
+	_, err := c.do(ctx, newCommand("QDLQ").key(queueKey).key(policy.DeadLetterQueue).int(policy.MaxDeliveries))
+	return err
+}
+
+// RemoveDeadLetterPolicy stops dead-lettering messages from queueKey.
+func (c *TempDBClient) RemoveDeadLetterPolicy(queueKey string) error {
+	return c.RemoveDeadLetterPolicyContext(context.Background(), queueKey)
+}
+
+// RemoveDeadLetterPolicyContext is like RemoveDeadLetterPolicy but honours ctx.
+func (c *TempDBClient) RemoveDeadLetterPolicyContext(ctx context.Context, queueKey string) error {
+	_, err := c.do(ctx, newCommand("QDLQ_REMOVE").key(queueKey))
+	return err
+}
+
+// DeadLetters returns up to count messages from a dead-letter queue, oldest
+// first, without removing them. count <= 0 returns them all.
+func (c *TempDBClient) DeadLetters(deadLetterQueue string, count int) ([]DeadLetter, error) {
+	return c.DeadLettersContext(context.Background(), deadLetterQueue, count)
+}
+
+// DeadLettersContext is like DeadLetters but honours ctx.
+func (c *TempDBClient) DeadLettersContext(ctx context.Context, deadLetterQueue string, count int) ([]DeadLetter, error) {
+	responseData, err := c.doRaw(ctx, withCount(newCommand("QDLQ_LIST").key(deadLetterQueue), count))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := decodeAs[[]deadLetter](responseData)
+	if err != nil {
+		return nil, err
+	}
+	letters := make([]DeadLetter, len(raw))
+	for i, d := range raw {
+		letters[i] = DeadLetter{
+			ID:             d.ID,
+			Queue:          d.Queue,
+			Payload:        d.Message,
+			LastError:      d.LastError,
+			DeliveryCount:  d.DeliveryCount,
+			EnqueuedAt:     time.UnixMilli(d.EnqueuedAt),
+			LastDelivered:  time.UnixMilli(d.LastDelivered),
+			DeadLetteredAt: time.UnixMilli(d.DeadLetteredAt),
+		}
+	}
+	return letters, nil
+}
+
+// ReplayDeadLetters moves messages from a dead-letter queue back onto the queues
+// they came from with their delivery counts reset, or every message if no IDs
+// are given. It returns how many messages were moved.
+func (c *TempDBClient) ReplayDeadLetters(deadLetterQueue string, ids ...string) (int, error) {
+	return c.ReplayDeadLettersContext(context.Background(), deadLetterQueue, ids...)
+}
+
+// ReplayDeadLettersContext is like ReplayDeadLetters but honours ctx.
+func (c *TempDBClient) ReplayDeadLettersContext(ctx context.Context, deadLetterQueue string, ids ...string) (int, error) {
+	cb := newCommand("QDLQ_REPLAY").key(deadLetterQueue)
+	for _, id := range ids {
+		cb.key(id)
+	}
+	result, err := c.do(ctx, cb)
+	if err != nil {
+		return 0, err
+	}
+	return countResult(result)
+}
+
+// PurgeDeadLetters deletes messages from a dead-letter queue, or every message if
+// no IDs are given. It returns how many messages were deleted.
+func (c *TempDBClient) PurgeDeadLetters(deadLetterQueue string, ids ...string) (int, error) {
+	return c.PurgeDeadLettersContext(context.Background(), deadLetterQueue, ids...)
+}
+
+// PurgeDeadLettersContext is like PurgeDeadLetters but honours ctx.
+func (c *TempDBClient) PurgeDeadLettersContext(ctx context.Context, deadLetterQueue string, ids ...string) (int, error) {
+	cb := newCommand("QDLQ_PURGE").key(deadLetterQueue)
+	for _, id := range ids {
+		cb.key(id)
+	}
+	result, err := c.do(ctx, cb)
+	if err != nil {
+		return 0, err
+	}
+	return countResult(result)
+}
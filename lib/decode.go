@@ -0,0 +1,205 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Entry is a value decoded into a Go type together with the metadata the server
+// keeps for it. CreatedAt and Expiry are nil when the server does not report them.
+type Entry[T any] struct {
+	Type      string // Type is the server's name for the value's type.
+	Value     T      // Value is the stored value.
+	CreatedAt *int64 // CreatedAt is when the value was stored.
+	Expiry    *int64 // Expiry is when the value expires.
+}
+
+// rawEntry is the wire form of a FormattedResponse with its value left undecoded.
+type rawEntry struct {
+	Type      string          `json:"type"`
+	Value     json.RawMessage `json:"value"`
+	CreatedAt *int64          `json:"created_at,omitempty"`
+	Expiry    *int64          `json:"expiry,omitempty"`
+}
+
+// decodeInto unmarshals the payload of responseData into v. A String payload that
+// holds JSON text, as queue messages often do, is decoded from that text when v
+// is not itself a string.
+func decodeInto(responseData ResponseData, v interface{}) error {
+	err := json.Unmarshal(responseData.Data, v)
+	if err != nil && responseData.Type == TypeString {
+		var text string
+		if json.Unmarshal(responseData.Data, &text) == nil && json.Unmarshal([]byte(text), v) == nil {
+			return nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decode %s response into %T: %w", responseData.Type, v, err)
+	}
+	return nil
+}
+
+// decodeAs decodes the payload of responseData into a T.
+func decodeAs[T any](responseData ResponseData) (T, error) {
+	var v T
+	err := decodeInto(responseData, &v)
+	return v, err
+}
+
+// decodeEntry decodes a GET_KEY payload. Values stored with metadata arrive as a
+// FormattedResponse; anything else is treated as the bare value.
+func decodeEntry[T any](responseData ResponseData) (*Entry[T], error) {
+	var raw rawEntry
+	if responseData.Type == TypeJson && json.Unmarshal(responseData.Data, &raw) == nil && raw.Type != "" && raw.Value != nil {
+		value, err := decodeAs[T](ResponseData{Type: raw.Type, Data: raw.Value})
+		if err != nil {
+			return nil, err
+		}
+		return &Entry[T]{Type: raw.Type, Value: value, CreatedAt: raw.CreatedAt, Expiry: raw.Expiry}, nil
+	}
+
+	value, err := decodeAs[T](responseData)
+	if err != nil {
+		return nil, err
+	}
+	return &Entry[T]{Type: responseData.Type, Value: value}, nil
+}
+
+// GetAs retrieves the value stored at key and decodes it into a T.
+func GetAs[T any](c *TempDBClient, key string) (T, error) {
+	return GetAsContext[T](context.Background(), c, key)
+}
+
+// GetAsContext is like GetAs but honours ctx.
+func GetAsContext[T any](ctx context.Context, c *TempDBClient, key string) (T, error) {
+	entry, err := GetEntryContext[T](ctx, c, key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return entry.Value, nil
+}
+
+// GetEntry retrieves the value stored at key, decoded into a T, along with its
+// creation time and expiry.
+func GetEntry[T any](c *TempDBClient, key string) (*Entry[T], error) {
+	return GetEntryContext[T](context.Background(), c, key)
+}
+
+// GetEntryContext is like GetEntry but honours ctx.
+func GetEntryContext[T any](ctx context.Context, c *TempDBClient, key string) (*Entry[T], error) {
+	responseData, err := c.doRaw(ctx, newCommand("GET_KEY").key(key))
+	if err != nil {
+		return nil, err
+	}
+	return decodeEntry[T](responseData)
+}
+
+// GetDocAs retrieves a document by its ID and decodes it into a T.
+func GetDocAs[T any](c *TempDBClient, docID string) (T, error) {
+	return GetDocAsContext[T](context.Background(), c, docID)
+}
+
+// GetDocAsContext is like GetDocAs but honours ctx.
+func GetDocAsContext[T any](ctx context.Context, c *TempDBClient, docID string) (T, error) {
+	responseData, err := c.doRaw(ctx, newCommand("GET_DOC").key(docID))
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return decodeAs[T](responseData)
+}
+
+// QueryDocsAs queries documents using a filter and decodes each match into a T.
+func QueryDocsAs[T any](c *TempDBClient, filter interface{}) ([]T, error) {
+	return QueryDocsAsContext[T](context.Background(), c, filter)
+}
+
+// QueryDocsAsContext is like QueryDocsAs but honours ctx.
+func QueryDocsAsContext[T any](ctx context.Context, c *TempDBClient, filter interface{}) ([]T, error) {
+	responseData, err := c.doRaw(ctx, newCommand("QUERY_DOCS").json(filter))
+	if err != nil {
+		return nil, err
+	}
+	result, err := decodeAs[struct {
+		Documents []T `json:"documents"`
+	}](responseData)
+	if err != nil {
+		return nil, err
+	}
+	return result.Documents, nil
+}
+
+// XReadAs reads entries from an event stream and decodes each one into a T.
+func XReadAs[T any](c *TempDBClient, streamKey, startID string, count int) ([]T, error) {
+	return XReadAsContext[T](context.Background(), c, streamKey, startID, count)
+}
+
+// XReadAsContext is like XReadAs but honours ctx.
+func XReadAsContext[T any](ctx context.Context, c *TempDBClient, streamKey, startID string, count int) ([]T, error) {
+	responseData, err := c.doRaw(ctx, newCommand("XREAD").key(streamKey).key(startID).int(count))
+	if err != nil {
+		return nil, err
+	}
+	return decodeAs[[]T](responseData)
+}
+
+// XReadGroupAs reads entries as a consumer of group, like TempDBClient.XReadGroup,
+// and decodes each one into a T.
+func XReadGroupAs[T any](c *TempDBClient, streamKey, group, consumer string, count int) ([]T, error) {
+	return XReadGroupAsContext[T](context.Background(), c, streamKey, group, consumer, count)
+}
+
+// XReadGroupAsContext is like XReadGroupAs but honours ctx.
+func XReadGroupAsContext[T any](ctx context.Context, c *TempDBClient, streamKey, group, consumer string, count int) ([]T, error) {
+	responseData, err := c.doRaw(ctx, newCommand("XREADGROUP").key(streamKey).key(group).key(consumer).int(count))
+	if err != nil {
+		return nil, err
+	}
+	return decodeAs[[]T](responseData)
+}
+
+// DequeueAs removes a message from a queue and decodes it into a T.
+func DequeueAs[T any](c *TempDBClient, queueKey string) (T, error) {
+	return DequeueAsContext[T](context.Background(), c, queueKey)
+}
+
+// DequeueAsContext is like DequeueAs but honours ctx.
+func DequeueAsContext[T any](ctx context.Context, c *TempDBClient, queueKey string) (T, error) {
+	responseData, err := c.doRaw(ctx, newCommand("DEQUEUE").key(queueKey))
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return decodeAs[T](responseData)
+}
+
+// QueryAs runs a query pipeline and decodes its result into a T.
+func QueryAs[T any](c *TempDBClient, pipeline string) (T, error) {
+	return QueryAsContext[T](context.Background(), c, pipeline)
+}
+
+// QueryAsContext is like QueryAs but honours ctx.
+func QueryAsContext[T any](ctx context.Context, c *TempDBClient, pipeline string) (T, error) {
+	responseData, err := c.doRaw(ctx, rawCommand("QUERY", pipeline))
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return decodeAs[T](responseData)
+}
+
+// QueryWithBuilderAs runs the query built by builder and decodes its result into a T.
+func QueryWithBuilderAs[T any](c *TempDBClient, builder *QueryBuilder) (T, error) {
+	return QueryWithBuilderAsContext[T](context.Background(), c, builder)
+}
+
+// QueryWithBuilderAsContext is like QueryWithBuilderAs but honours ctx.
+func QueryWithBuilderAsContext[T any](ctx context.Context, c *TempDBClient, builder *QueryBuilder) (T, error) {
+	if err := builder.Err(); err != nil {
+		var zero T
+		return zero, err
+	}
+	return QueryAsContext[T](ctx, c, builder.Build())
+}
@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"errors"
+	"strings"
+)
+
+// Sentinel errors returned by client methods. Test for them with errors.Is; errors
+// reported by the server are *ServerError values that match the sentinel for
+// their kind, so both
+//
+//	errors.Is(err, ErrEmptyQueue)
+//
+// and
+//
+//	var serverErr *ServerError
+//	errors.As(err, &serverErr)
+//
+// work on the same error.
+var (
+	// ErrNotFound is matched by server errors for a missing key, document, stream or queue.
+	ErrNotFound = errors.New("tempdb: not found")
+	// ErrEmptyQueue is matched by the server error for dequeuing from an empty queue.
+	ErrEmptyQueue = errors.New("tempdb: queue is empty")
+	// ErrAuthFailed is returned when the server rejects the connection string.
+	ErrAuthFailed = errors.New("tempdb: authentication failed")
+	// ErrWrongDatabaseType is matched by server errors for commands the database's type does not support.
+	ErrWrongDatabaseType = errors.New("tempdb: command not supported by this database type")
+	// ErrQueueTimeout is returned by blocking dequeues when no message arrived in time.
+	ErrQueueTimeout = errors.New("tempdb: timed out waiting for a queue message")
+	// ErrConnectionClosed is returned for commands on a closed or failed connection.
+	ErrConnectionClosed = errors.New("tempdb: connection closed")
+	// ErrPoolClosed is returned when checking a client out of a closed Pool.
+	ErrPoolClosed = errors.New("tempdb: pool is closed")
+	// ErrPoolTimeout is returned when no connection became available within PoolConfig.WaitTimeout.
+	ErrPoolTimeout = errors.New("tempdb: timed out waiting for a pooled connection")
+)
+
+// ServerError is an error reply from the server.
+type ServerError struct {
+	Code    string // Code is the machine readable error code, when the server sends one.
+	Message string // Message is the server's error message.
+	Command string // Command is the keyword of the command that failed, such as DEQUEUE.
+}
+
+// Error returns the server's message unchanged.
+func (e *ServerError) Error() string {
+	return e.Message
+}
+
+// Is reports whether the error is of the kind described by one of the sentinel errors.
+func (e *ServerError) Is(target error) bool {
+	return target != nil && e.kind() == target
+}
+
+// kind classifies the error by its code, falling back to the wording of its message.
+func (e *ServerError) kind() error {
+	code := strings.ToUpper(e.Code)
+	msg := strings.ToLower(e.Message)
+	switch {
+	case code == "EMPTY" || strings.TrimSpace(msg) == "empty" || strings.Contains(msg, "queue is empty"):
+		return ErrEmptyQueue
+	case code == "NOT_FOUND" || strings.Contains(msg, "not found") || strings.Contains(msg, "does not exist"):
+		return ErrNotFound
+	case code == "WRONG_TYPE" || strings.Contains(msg, "wrong database type") || strings.Contains(msg, "not supported"):
+		return ErrWrongDatabaseType
+	case code == "TIMEOUT" || strings.Contains(msg, "timed out waiting"):
+		return ErrQueueTimeout
+	case code == "AUTH_FAILED" || strings.Contains(msg, "authentication failed") || strings.Contains(msg, "unauthorized"):
+		return ErrAuthFailed
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestServerErrorIs(t *testing.T) {
+	tests := []struct {
+		err  ServerError
+		want error
+	}{
+		{ServerError{Code: "EMPTY"}, ErrEmptyQueue},
+		{ServerError{Message: "Empty"}, ErrEmptyQueue},
+		{ServerError{Message: "Queue is empty"}, ErrEmptyQueue},
+		{ServerError{Code: "not_found"}, ErrNotFound},
+		{ServerError{Message: "Key not found"}, ErrNotFound},
+		{ServerError{Message: "Stream does not exist"}, ErrNotFound},
+		{ServerError{Code: "WRONG_TYPE"}, ErrWrongDatabaseType},
+		{ServerError{Message: "Command not supported for this database"}, ErrWrongDatabaseType},
+		{ServerError{Code: "TIMEOUT"}, ErrQueueTimeout},
+		{ServerError{Message: "Timed out waiting for message"}, ErrQueueTimeout},
+		{ServerError{Code: "AUTH_FAILED"}, ErrAuthFailed},
+		{ServerError{Message: "Unauthorized"}, ErrAuthFailed},
+		{ServerError{Message: "syntax error"}, nil},
+	}
+	sentinels := []error{ErrEmptyQueue, ErrNotFound, ErrWrongDatabaseType, ErrQueueTimeout, ErrAuthFailed}
+	for _, tt := range tests {
+		var err error = &tt.err
+		for _, sentinel := range sentinels {
+			if got := errors.Is(err, sentinel); got != (sentinel == tt.want) {
+				t.Errorf("errors.Is(%+v, %v) = %v, want %v", tt.err, sentinel, got, !got)
+			}
+		}
+	}
+}
+
+func TestWriteFailedMatchesConnectionClosed(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	cn := newConnection(client)
+	defer cn.Close()
+
+	err := cn.writeFailed(context.Background(), io.ErrClosedPipe)
+	if !errors.Is(err, ErrConnectionClosed) || !errors.Is(err, io.ErrClosedPipe) {
+		t.Fatalf("writeFailed returned %v, want it to match ErrConnectionClosed and the write error", err)
+	}
+	if !errors.Is(cn.Err(), ErrConnectionClosed) {
+		t.Fatalf("connection error is %v, want ErrConnectionClosed", cn.Err())
+	}
+}
@@ -0,0 +1,141 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// envelopeVersion marks a published message as an envelope written by PublishJSON.
+const envelopeVersion = 1
+
+// Message is a message received on a subscribed channel. Messages published with
+// PublishJSON or PublishMessage also carry their publish time and headers; for
+// plain messages sent with Publish, PublishedAt is zero and Headers is nil.
+type Message struct {
+	Channel     string            // Channel is the channel the message was published to.
+	Pattern     string            // Pattern is the pattern subscription that matched Channel, or "" for a channel subscription.
+	Payload     []byte            // Payload is the published message; JSON for messages sent with PublishJSON.
+	PublishedAt time.Time         // PublishedAt is when the message was published, if known.
+	Headers     map[string]string // Headers are the metadata the publisher attached, if any.
+}
+
+// envelope is the wire form of a message published with PublishJSON or PublishMessage.
+type envelope struct {
+	Version     int               `json:"tempdb_envelope"`
+	PublishedAt time.Time         `json:"published_at"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Payload     json.RawMessage   `json:"payload"`
+}
+
+// Decode unmarshals the message's JSON payload into v. A plain message whose text
+// is JSON decodes too.
+func (m Message) Decode(v interface{}) error {
+	if err := json.Unmarshal(m.Payload, v); err != nil {
+		return fmt.Errorf("failed to decode message on %s into %T: %w", m.Channel, v, err)
+	}
+	return nil
+}
+
+// parseMessage splits a pushed message into the pattern that matched, the channel
+// and the published message, unwrapping an envelope if there is one.
+func parseMessage(push string) Message {
+	var msg Message
+	kind, rest, _ := strings.Cut(push, " ")
+	var err error
+	if kind == "PMSG" {
+		if msg.Pattern, rest, err = nextArg(rest); err != nil {
+			return Message{Payload: []byte(push)}
+		}
+	}
+	if msg.Channel, rest, err = nextArg(rest); err != nil {
+		return Message{Payload: []byte(push)}
+	}
+	if strings.HasPrefix(rest, `"`) {
+		if message, tail, err := nextArg(rest); err == nil && tail == "" {
+			rest = message
+		}
+	}
+
+	var env envelope
+	if json.Unmarshal([]byte(rest), &env) == nil && env.Version == envelopeVersion && env.Payload != nil {
+		msg.Payload = env.Payload
+		msg.PublishedAt = env.PublishedAt
+		msg.Headers = env.Headers
+		return msg
+	}
+	msg.Payload = []byte(rest)
+	return msg
+}
+
+// newEnvelope wraps the JSON encoding of v, stamped with the current time.
+func newEnvelope(v interface{}, headers map[string]string) (envelope, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return envelope{}, fmt.Errorf("failed to encode message: %w", err)
+	}
+	return envelope{Version: envelopeVersion, PublishedAt: time.Now().UTC(), Headers: headers, Payload: payload}, nil
+}
+
+// PublishJSON publishes v, encoded as JSON, to a Pub/Sub channel together with the
+// time it was published. It returns the number of subscribers that received it.
+func (c *TempDBClient) PublishJSON(channel string, v interface{}) (int, error) {
+	return c.PublishJSONContext(context.Background(), channel, v)
+}
+
+// PublishJSONContext is like PublishJSON but honours ctx.
+func (c *TempDBClient) PublishJSONContext(ctx context.Context, channel string, v interface{}) (int, error) {
+	return c.PublishMessageContext(ctx, channel, v, nil)
+}
+
+// PublishMessage is like PublishJSON but also attaches headers to the message.
+func (c *TempDBClient) PublishMessage(channel string, v interface{}, headers map[string]string) (int, error) {
+	return c.PublishMessageContext(context.Background(), channel, v, headers)
+}
+
+// PublishMessageContext is like PublishMessage but honours ctx.
+func (c *TempDBClient) PublishMessageContext(ctx context.Context, channel string, v interface{}, headers map[string]string) (int, error) {
+	env, err := newEnvelope(v, headers)
+	if err != nil {
+		return 0, err
+	}
+	result, err := c.do(ctx, newCommand("PUBLISH").key(channel).json(env))
+	if err != nil {
+		return 0, err
+	}
+	return publishCount(result)
+}
+
+// TypedMessage is a received message together with its payload decoded into a T.
+// Err is set, and Value is the zero value, when the payload could not be decoded.
+type TypedMessage[T any] struct {
+	Message
+	Value T
+	Err   error
+}
+
+// ChannelAs returns a channel on which every message received by p arrives with
+// its payload decoded into a T. Messages that fail to decode are delivered with
+// Err set rather than dropped. ChannelAs consumes p.Channel, so p must not be read
+// elsewhere; the returned channel is closed when p.Channel is.
+func ChannelAs[T any](p *PubSub) <-chan TypedMessage[T] {
+	typed := make(chan TypedMessage[T], messageBuffer)
+	go func() {
+		defer close(typed)
+		for msg := range p.Channel() {
+			tm := TypedMessage[T]{Message: msg}
+			var value T
+			if tm.Err = msg.Decode(&value); tm.Err == nil {
+				tm.Value = value
+			}
+			select {
+			case typed <- tm:
+			case <-p.ctx.Done():
+				return
+			}
+		}
+	}()
+	return typed
+}
@@ -0,0 +1,286 @@
+package lib
+
+import (
+	"cmp"
+	"context"
+	"errors"
+)
+
+// errNotExecuted is reported by a PipelineResult whose pipeline has not run yet.
+var errNotExecuted = errors.New("pipeline has not been executed")
+
+// Pipeline queues commands and sends them to the server in a single write, then
+// reads their replies in order. It costs one round trip however many commands
+// are queued. A Pipeline is not safe for concurrent use; create one per goroutine.
+//
+//	pipe := client.Pipeline()
+//	id := pipe.XAdd("events", event)
+//	pipe.Store("last_event", event)
+//	if err := pipe.Exec(); err != nil {
+//		log.Println(err)
+//	}
+//	log.Println(id.Val())
+type Pipeline struct {
+	client *TempDBClient
+	cmds   []pipelineCmd
+	err    error // err is the first error of a command that could not be queued.
+}
+
+// pipelineCmd is a queued command and the function that hands its reply to the
+// PipelineResult returned when it was queued.
+type pipelineCmd struct {
+	command string
+	resolve func(result interface{}, err error)
+}
+
+// PipelineResult holds the outcome of one queued command once its Pipeline has run.
+type PipelineResult[T any] struct {
+	val T
+	err error
+}
+
+// Result returns the command's value and error.
+func (r *PipelineResult[T]) Result() (T, error) {
+	return r.val, r.err
+}
+
+// Val returns the command's value, or the zero value if it failed.
+func (r *PipelineResult[T]) Val() T {
+	return r.val
+}
+
+// Err returns the command's error, if any.
+func (r *PipelineResult[T]) Err() error {
+	return r.err
+}
+
+// Pipeline returns an empty pipeline that runs its commands on this client.
+func (c *TempDBClient) Pipeline() *Pipeline {
+	return &Pipeline{client: c}
+}
+
+// Len returns the number of queued commands.
+func (p *Pipeline) Len() int {
+	return len(p.cmds)
+}
+
+// Discard drops every queued command without sending it.
+func (p *Pipeline) Discard() {
+	for _, cmd := range p.cmds {
+		cmd.resolve(nil, errors.New("pipeline discarded"))
+	}
+	p.cmds = nil
+	p.err = nil
+}
+
+// Exec sends every queued command and waits for all of their replies. It returns
+// the first error of any command, including one rejected when it was queued for
+// an invalid argument; inspect each PipelineResult for the others. The pipeline
+// is empty afterwards and can be reused.
+func (p *Pipeline) Exec() error {
+	return p.ExecContext(context.Background())
+}
+
+// ExecContext is like Exec but honours ctx. If ctx is done before every reply has
+// arrived, the remaining commands fail with ctx's error; they may still have been
+// applied by the server. A dropped connection is re-established before the
+// commands are sent, but commands are never resent once written.
+func (p *Pipeline) ExecContext(ctx context.Context) error {
+	cmds, queueErr := p.cmds, p.err
+	p.cmds, p.err = nil, nil
+	if len(cmds) == 0 {
+		return queueErr
+	}
+
+	c := p.client
+	if err := c.lock(ctx); err != nil {
+		return cmp.Or(queueErr, p.failAll(cmds, err))
+	}
+	defer c.unlock()
+
+	if err := c.ensureConnected(ctx); err != nil {
+		return cmp.Or(queueErr, p.failAll(cmds, err))
+	}
+
+	lines := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		lines[i] = c.commandLine(cmd.command)
+	}
+	waiters, err := c.conn.send(ctx, lines...)
+	if err != nil {
+		return cmp.Or(queueErr, p.failAll(cmds, err))
+	}
+
+	firstErr := queueErr
+	for i, cmd := range cmds {
+		respBytes, err := c.conn.await(ctx, waiters[i])
+		var result interface{}
+		if err == nil {
+			var responseData ResponseData
+			if responseData, err = parseResponse(cmd.command, respBytes); err == nil {
+				result, err = decodeResponseData(responseData)
+			}
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		cmd.resolve(result, err)
+	}
+	return firstErr
+}
+
+func (p *Pipeline) failAll(cmds []pipelineCmd, err error) error {
+	for _, cmd := range cmds {
+		cmd.resolve(nil, err)
+	}
+	return err
+}
+
+// queue adds the command built by cb to p, converting its eventual result with
+// convert. A command with an invalid argument is not queued; its result reports
+// the error instead, as does the next Exec.
+func queue[T any](p *Pipeline, cb *commandBuilder, convert func(interface{}) (T, error)) *PipelineResult[T] {
+	command, err := cb.build()
+	if err != nil {
+		return reject[T](p, err)
+	}
+
+	r := &PipelineResult[T]{err: errNotExecuted}
+	p.cmds = append(p.cmds, pipelineCmd{
+		command: command,
+		resolve: func(result interface{}, err error) {
+			if err != nil {
+				var zero T
+				r.val, r.err = zero, err
+				return
+			}
+			r.val, r.err = convert(result)
+		},
+	})
+	return r
+}
+
+// reject records err as the error of a command that could not be queued.
+func reject[T any](p *Pipeline, err error) *PipelineResult[T] {
+	if p.err == nil {
+		p.err = err
+	}
+	return &PipelineResult[T]{err: err}
+}
+
+func asIs(result interface{}) (interface{}, error) {
+	return result, nil
+}
+
+func noValue(interface{}) (struct{}, error) {
+	return struct{}{}, nil
+}
+
+// Set queues a SET command. See TempDBClient.Set.
+func (p *Pipeline) Set(key, value string) *PipelineResult[struct{}] {
+	return queue(p, newCommand("SET").key(key).value(value), noValue)
+}
+
+// Get queues a GET_KEY command. See TempDBClient.Get.
+func (p *Pipeline) Get(key string) *PipelineResult[string] {
+	return queue(p, newCommand("GET_KEY").key(key), formatResponse)
+}
+
+// SetEx queues a SETEX command. See TempDBClient.SetEx.
+func (p *Pipeline) SetEx(key string, seconds int, value interface{}) *PipelineResult[interface{}] {
+	return queue(p, newCommand("SETEX").key(key).int(seconds).json(value), asIs)
+}
+
+// Delete queues a DELETE_KEY command. See TempDBClient.Delete.
+func (p *Pipeline) Delete(key string) *PipelineResult[interface{}] {
+	return queue(p, newCommand("DELETE_KEY").key(key), asIs)
+}
+
+// Store queues a STORE command. See TempDBClient.Store.
+func (p *Pipeline) Store(key string, value interface{}) *PipelineResult[interface{}] {
+	return queue(p, newCommand("STORE").key(key).json(value), asIs)
+}
+
+// Batch queues a Batch command. See TempDBClient.Batch.
+func (p *Pipeline) Batch(entries map[string]interface{}) *PipelineResult[interface{}] {
+	return queue(p, newCommand("Batch").json(entries), asIs)
+}
+
+// InsertDoc queues an INSERT_DOC command. See TempDBClient.InsertDoc.
+func (p *Pipeline) InsertDoc(document interface{}) *PipelineResult[string] {
+	return queue(p, newCommand("INSERT_DOC").json(document), documentID)
+}
+
+// GetDoc queues a GET_DOC command. See TempDBClient.GetDoc.
+func (p *Pipeline) GetDoc(docID string) *PipelineResult[map[string]interface{}] {
+	return queue(p, newCommand("GET_DOC").key(docID), document)
+}
+
+// UpdateDoc queues an UPDATE_DOC command. See TempDBClient.UpdateDoc.
+func (p *Pipeline) UpdateDoc(docID string, update interface{}) *PipelineResult[map[string]interface{}] {
+	return queue(p, newCommand("UPDATE_DOC").key(docID).json(update), document)
+}
+
+// DeleteDoc queues a DELETE_DOC command. See TempDBClient.DeleteDoc.
+func (p *Pipeline) DeleteDoc(docID string) *PipelineResult[struct{}] {
+	return queue(p, newCommand("DELETE_DOC").key(docID), noValue)
+}
+
+// Publish queues a PUBLISH command. See TempDBClient.Publish.
+func (p *Pipeline) Publish(channel, message string) *PipelineResult[int] {
+	return queue(p, newCommand("PUBLISH").key(channel).value(message), publishCount)
+}
+
+// PublishJSON queues a PUBLISH command carrying v as JSON. See TempDBClient.PublishJSON.
+func (p *Pipeline) PublishJSON(channel string, v interface{}) *PipelineResult[int] {
+	env, err := newEnvelope(v, nil)
+	if err != nil {
+		return reject[int](p, err)
+	}
+	return queue(p, newCommand("PUBLISH").key(channel).json(env), publishCount)
+}
+
+// XAdd queues an XADD command. See TempDBClient.XAdd.
+func (p *Pipeline) XAdd(streamKey string, data interface{}) *PipelineResult[string] {
+	return queue(p, newCommand("XADD").key(streamKey).json(data), streamID)
+}
+
+// XRead queues an XREAD command. See TempDBClient.XRead.
+func (p *Pipeline) XRead(streamKey, startID string, count int) *PipelineResult[[]map[string]interface{}] {
+	return queue(p, newCommand("XREAD").key(streamKey).key(startID).int(count), streamEntries)
+}
+
+// Enqueue queues an ENQUEUE command. See TempDBClient.Enqueue.
+func (p *Pipeline) Enqueue(queueKey string, message interface{}) *PipelineResult[struct{}] {
+	return queue(p, newCommand("ENQUEUE").key(queueKey).json(message), noValue)
+}
+
+// Dequeue queues a DEQUEUE command. See TempDBClient.Dequeue.
+func (p *Pipeline) Dequeue(queueKey string) *PipelineResult[interface{}] {
+	return queue(p, newCommand("DEQUEUE").key(queueKey), asIs)
+}
+
+// QPeek queues a QPEEK command. See TempDBClient.QPeek.
+func (p *Pipeline) QPeek(queueKey string) *PipelineResult[interface{}] {
+	return queue(p, newCommand("QPEEK").key(queueKey), asIs)
+}
+
+// QLen queues a QLEN command. See TempDBClient.QLen.
+func (p *Pipeline) QLen(queueKey string) *PipelineResult[interface{}] {
+	return queue(p, newCommand("QLEN").key(queueKey), asIs)
+}
+
+// VSet queues a VSet command. See TempDBClient.VSet.
+func (p *Pipeline) VSet(key string, vector []float32, metadata interface{}) *PipelineResult[interface{}] {
+	return queue(p, newCommand("VSet").key(key).json(vector).json(metadata), asIs)
+}
+
+// VGet queues a VGet command. See TempDBClient.VGet.
+func (p *Pipeline) VGet(key string) *PipelineResult[string] {
+	return queue(p, newCommand("VGet").key(key), formatResponse)
+}
+
+// Query queues a QUERY command. See TempDBClient.Query.
+func (p *Pipeline) Query(pipeline string) *PipelineResult[interface{}] {
+	return queue(p, rawCommand("QUERY", pipeline), asIs)
+}
@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPipelineRepliesInOrder(t *testing.T) {
+	s := newFakeServer(t, func(fc *fakeConn, command string) {
+		key := keyOf(command)
+		if key == "a" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		fc.reply(TypeString, key)
+	})
+	client, err := NewClient(s.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	pipe := client.Pipeline()
+	keys := []string{"a", "b", "c", "d"}
+	results := make([]*PipelineResult[interface{}], len(keys))
+	for i, key := range keys {
+		results[i] = pipe.Delete(key)
+	}
+	if err := pipe.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range keys {
+		if got := results[i].Val(); got != key {
+			t.Errorf("result %d = %v, want %q", i, got, key)
+		}
+	}
+	if pipe.Len() != 0 {
+		t.Errorf("Len after Exec = %d, want 0", pipe.Len())
+	}
+}
+
+func TestPipelineReportsQueueTimeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		queue   func(p *Pipeline) error
+		wantRun int // wantRun is how many commands reach the server.
+	}{
+		{
+			name: "only invalid",
+			queue: func(p *Pipeline) error {
+				return p.Set("", "x").Err()
+			},
+		},
+		{
+			name: "invalid among valid",
+			queue: func(p *Pipeline) error {
+				p.Delete("a")
+				err := p.Set("", "x").Err()
+				p.Delete("b")
+				return err
+			},
+			wantRun: 2,
+		},
+		{
+			name: "unencodable JSON",
+			queue: func(p *Pipeline) error {
+				return p.Store("k", func() {}).Err()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commands := make(chan string, 10)
+			s := newFakeServer(t, func(fc *fakeConn, command string) {
+				commands <- command
+				fc.ok()
+			})
+			client, err := NewClient(s.config())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+
+			pipe := client.Pipeline()
+			queueErr := tt.queue(pipe)
+			if queueErr == nil {
+				t.Fatal("queueing an invalid command reported no error")
+			}
+			if err := pipe.Exec(); !errors.Is(err, queueErr) {
+				t.Fatalf("Exec returned %v, want %v", err, queueErr)
+			}
+			if len(commands) != tt.wantRun {
+				t.Fatalf("server received %d commands, want %d", len(commands), tt.wantRun)
+			}
+			if err := pipe.Exec(); err != nil {
+				t.Fatalf("second Exec returned %v, want nil", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,399 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultMaxIdle matches the size of the pool NewClient always used.
+const defaultMaxIdle = 10
+
+// PoolConfig controls how a Pool manages its connections. The zero value keeps
+// up to 10 idle connections, never limits open connections and never expires them.
+type PoolConfig struct {
+	MinIdle         int           // MinIdle connections are kept open in the background.
+	MaxIdle         int           // MaxIdle caps the idle connections kept for reuse; 0 means 10.
+	MaxOpen         int           // MaxOpen caps idle plus checked out connections; 0 means unlimited.
+	MaxLifetime     time.Duration // MaxLifetime closes connections older than this; 0 means forever.
+	IdleTimeout     time.Duration // IdleTimeout closes connections idle for longer than this; 0 means forever.
+	WaitTimeout     time.Duration // WaitTimeout bounds how long Get waits when MaxOpen is reached; 0 waits for ctx.
+	SkipHealthCheck bool          // SkipHealthCheck disables the PING sent when an idle connection is checked out.
+}
+
+// PoolStats is a snapshot of a Pool's state and counters.
+type PoolStats struct {
+	Open                int           // Open is the number of connections, idle and in use.
+	Idle                int           // Idle is the number of connections waiting to be checked out.
+	InUse               int           // InUse is the number of checked out connections.
+	Hits                int64         // Hits counts checkouts served by an idle connection.
+	Misses              int64         // Misses counts checkouts that dialed a new connection.
+	WaitCount           int64         // WaitCount counts checkouts that had to wait for MaxOpen.
+	WaitDuration        time.Duration // WaitDuration is the total time spent waiting.
+	Timeouts            int64         // Timeouts counts checkouts that gave up waiting.
+	HealthCheckFailures int64         // HealthCheckFailures counts idle connections that failed their PING.
+	Expired             int64         // Expired counts connections closed for MaxLifetime or IdleTimeout.
+}
+
+// Pool is a set of authenticated connections for a single Config. Clients checked
+// out with Get go back to the pool they came from when closed, so connections are
+// never shared between configurations.
+type Pool struct {
+	config Config
+	opts   PoolConfig
+
+	mu      sync.Mutex
+	idle    []*TempDBClient
+	open    int
+	waiters []chan struct{}
+	closed  bool
+	stats   PoolStats
+	stop    chan struct{}
+}
+
+// poolKey identifies the server and collection a Config connects to. Shared pools
+// are keyed by it rather than by the whole Config, whose pointer fields would give
+// a config built afresh for each NewClient call a pool of its own.
+type poolKey struct {
+	addr string
+	url  string
+	tls  bool
+}
+
+var (
+	poolsMu sync.Mutex
+	pools   = map[poolKey]*Pool{}
+)
+
+func (config Config) poolKey() poolKey {
+	return poolKey{addr: config.Addr, url: config.connectionString(), tls: config.usesTLS()}
+}
+
+// NewPool creates a pool for config using config.Pool as its settings.
+func NewPool(config Config) *Pool {
+	opts := config.Pool
+	if opts.MaxIdle <= 0 {
+		opts.MaxIdle = defaultMaxIdle
+	}
+	if opts.MaxOpen > 0 && opts.MaxIdle > opts.MaxOpen {
+		opts.MaxIdle = opts.MaxOpen
+	}
+	if opts.MinIdle > opts.MaxIdle {
+		opts.MinIdle = opts.MaxIdle
+	}
+
+	p := &Pool{config: config, opts: opts, stop: make(chan struct{})}
+	if opts.MinIdle > 0 || opts.IdleTimeout > 0 || opts.MaxLifetime > 0 {
+		go p.maintain()
+	}
+	return p
+}
+
+// sharedPool returns the pool NewClient uses for config, creating it on first use.
+// Configs for the same address, collection and TLS setting share a pool, which
+// keeps the settings of the config that created it.
+func sharedPool(config Config) *Pool {
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+
+	key := config.poolKey()
+	p, ok := pools[key]
+	if !ok || p.isClosed() {
+		p = NewPool(config)
+		pools[key] = p
+	}
+	return p
+}
+
+// Get checks out a client, reusing an idle connection when one is healthy and
+// dialing a new one otherwise. When MaxOpen connections are already open it waits
+// for one to be returned, up to WaitTimeout or until ctx is done.
+func (p *Pool) Get(ctx context.Context) (*TempDBClient, error) {
+	var waitCtx context.Context // waitCtx bounds waiting for MaxOpen; it is created on the first wait.
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+
+		if n := len(p.idle); n > 0 {
+			client := p.idle[n-1]
+			p.idle = p.idle[:n-1]
+			if p.expired(client, time.Now()) {
+				p.stats.Expired++
+				p.closeLocked(client)
+				p.mu.Unlock()
+				continue
+			}
+			client.idle = false
+			p.mu.Unlock()
+
+			if !p.opts.SkipHealthCheck {
+				if _, err := client.PingContext(ctx); err != nil {
+					p.mu.Lock()
+					p.stats.HealthCheckFailures++
+					p.closeLocked(client)
+					p.mu.Unlock()
+					if ctxErr := ctx.Err(); ctxErr != nil {
+						return nil, p.waitError(ctxErr)
+					}
+					continue
+				}
+			}
+
+			p.mu.Lock()
+			p.stats.Hits++
+			p.mu.Unlock()
+			return client, nil
+		}
+
+		if p.opts.MaxOpen <= 0 || p.open < p.opts.MaxOpen {
+			p.open++
+			p.stats.Misses++
+			p.mu.Unlock()
+
+			client, err := p.dial(ctx)
+			if err != nil {
+				p.mu.Lock()
+				p.open--
+				p.notifyLocked()
+				p.mu.Unlock()
+				return nil, err
+			}
+			return client, nil
+		}
+
+		if waitCtx == nil {
+			waitCtx = ctx
+			if p.opts.WaitTimeout > 0 {
+				var cancel context.CancelFunc
+				waitCtx, cancel = context.WithTimeout(ctx, p.opts.WaitTimeout)
+				defer cancel()
+			}
+		}
+		if err := p.wait(waitCtx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// wait blocks until a connection is returned or closed. It is called with p.mu
+// held and returns with it released.
+func (p *Pool) wait(ctx context.Context) error {
+	ready := make(chan struct{}, 1)
+	p.waiters = append(p.waiters, ready)
+	p.stats.WaitCount++
+	p.mu.Unlock()
+
+	start := time.Now()
+	select {
+	case <-ready:
+		p.mu.Lock()
+		p.stats.WaitDuration += time.Since(start)
+		p.mu.Unlock()
+		return nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.stats.WaitDuration += time.Since(start)
+		p.stats.Timeouts++
+		for i, w := range p.waiters {
+			if w == ready {
+				p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+				break
+			}
+		}
+		// A notification may have raced with the timeout; hand it on.
+		select {
+		case <-ready:
+			p.notifyLocked()
+		default:
+		}
+		return p.waitError(ctx.Err())
+	}
+}
+
+func (p *Pool) waitError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrPoolTimeout, err)
+	}
+	return err
+}
+
+func (p *Pool) dial(ctx context.Context) (*TempDBClient, error) {
+	client, err := createClient(ctx, p.config)
+	if err != nil {
+		return nil, err
+	}
+	client.pool = p
+	return client, nil
+}
+
+// put returns a client to the pool, closing it instead when it is broken, expired,
+// subscribed, surplus to MaxIdle or the pool is closed. A subscribed connection
+// would keep delivering its messages to the previous owner's handler.
+func (p *Pool) put(client *TempDBClient) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if client.idle {
+		return
+	}
+	if p.closed || client.conn.Err() != nil || client.subscribed || len(p.idle) >= p.opts.MaxIdle {
+		p.closeLocked(client)
+		return
+	}
+	if p.expired(client, time.Now()) {
+		p.stats.Expired++
+		p.closeLocked(client)
+		return
+	}
+
+	client.idle = true
+	client.returnedAt = time.Now()
+	p.idle = append(p.idle, client)
+	p.notifyLocked()
+}
+
+func (p *Pool) expired(client *TempDBClient, now time.Time) bool {
+	if p.opts.MaxLifetime > 0 && now.Sub(client.createdAt) > p.opts.MaxLifetime {
+		return true
+	}
+	if client.idle && p.opts.IdleTimeout > 0 && now.Sub(client.returnedAt) > p.opts.IdleTimeout {
+		return true
+	}
+	return false
+}
+
+func (p *Pool) closeLocked(client *TempDBClient) {
+	client.idle = false
+	client.pool = nil
+	client.closed = true
+	client.conn.Close()
+	p.open--
+	p.notifyLocked()
+}
+
+// notifyLocked wakes the longest waiting Get, if any.
+func (p *Pool) notifyLocked() {
+	if len(p.waiters) == 0 {
+		return
+	}
+	ready := p.waiters[0]
+	p.waiters = p.waiters[1:]
+	ready <- struct{}{}
+}
+
+// maintain periodically closes expired idle connections and tops the pool up to MinIdle.
+func (p *Pool) maintain() {
+	interval := time.Minute
+	for _, d := range []time.Duration{p.opts.IdleTimeout / 2, p.opts.MaxLifetime / 2} {
+		if d > 0 && d < interval {
+			interval = d
+		}
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.reap()
+		p.fill()
+		select {
+		case <-ticker.C:
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *Pool) reap() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	kept := p.idle[:0]
+	for _, client := range p.idle {
+		if p.expired(client, now) {
+			p.stats.Expired++
+			p.closeLocked(client)
+			continue
+		}
+		kept = append(kept, client)
+	}
+	p.idle = kept
+}
+
+func (p *Pool) fill() {
+	for {
+		p.mu.Lock()
+		if p.closed || len(p.idle) >= p.opts.MinIdle || (p.opts.MaxOpen > 0 && p.open >= p.opts.MaxOpen) {
+			p.mu.Unlock()
+			return
+		}
+		p.open++
+		p.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+		client, err := p.dial(ctx)
+		cancel()
+		if err != nil {
+			p.mu.Lock()
+			p.open--
+			p.notifyLocked()
+			p.mu.Unlock()
+			return
+		}
+		p.put(client)
+	}
+}
+
+// Stats returns a snapshot of the pool's connections and counters.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := p.stats
+	stats.Open = p.open
+	stats.Idle = len(p.idle)
+	stats.InUse = p.open - len(p.idle)
+	return stats
+}
+
+// Close closes every idle connection and stops handing out new ones. Clients that
+// are still checked out are closed when they are returned.
+func (p *Pool) Close() error {
+	poolsMu.Lock()
+	if key := p.config.poolKey(); pools[key] == p {
+		delete(pools, key)
+	}
+	poolsMu.Unlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	close(p.stop)
+	for _, client := range p.idle {
+		p.closeLocked(client)
+	}
+	p.idle = nil
+	for len(p.waiters) > 0 {
+		p.notifyLocked()
+	}
+	return nil
+}
+
+func (p *Pool) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
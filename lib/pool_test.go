@@ -0,0 +1,92 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSharedPoolIgnoresPointerFields(t *testing.T) {
+	s := newFakeServer(t, func(fc *fakeConn, command string) {
+		fc.reply(TypeString, "PONG")
+	})
+
+	var first *TempDBClient
+	for i := range 5 {
+		// Built per call, as the README's reconnect example does.
+		config := s.config()
+		config.Hooks = &Hooks{}
+		client, err := NewClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			first = client
+		} else if client != first {
+			t.Fatalf("call %d got a new connection instead of the pooled one", i)
+		}
+		client.Close()
+	}
+	if open := sharedPool(s.config()).Stats().Open; open != 1 {
+		t.Fatalf("pool has %d connections open, want 1", open)
+	}
+}
+
+func TestClosedSharedPoolIsForgotten(t *testing.T) {
+	s := newFakeServer(t, func(fc *fakeConn, command string) {})
+	p := sharedPool(s.config())
+	p.Close()
+
+	poolsMu.Lock()
+	_, ok := pools[s.config().poolKey()]
+	poolsMu.Unlock()
+	if ok {
+		t.Fatal("closed pool is still registered")
+	}
+}
+
+func TestWaitTimeoutOnlyBoundsWaiting(t *testing.T) {
+	s := newFakeServer(t, func(fc *fakeConn, command string) {
+		fc.reply(TypeString, "PONG")
+	})
+	s.setAuthDelay(100 * time.Millisecond)
+	config := s.config()
+	config.Pool = PoolConfig{MaxOpen: 1, WaitTimeout: 50 * time.Millisecond}
+	p := NewPool(config)
+	defer p.Close()
+
+	// Dialing and authenticating take longer than WaitTimeout but involve no waiting.
+	client, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := p.Get(context.Background()); !errors.Is(err, ErrPoolTimeout) {
+		t.Fatalf("Get at MaxOpen returned %v, want ErrPoolTimeout", err)
+	}
+}
+
+func TestSubscribedClientIsNotPooled(t *testing.T) {
+	s := newFakeServer(t, func(fc *fakeConn, command string) {
+		fc.ok()
+	})
+	client, err := NewClient(s.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Subscribe("chat", func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	next, err := NewClient(s.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer next.Close()
+	if next == client {
+		t.Fatal("subscribed client was returned to the pool")
+	}
+}
@@ -0,0 +1,344 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// messageBuffer is how many received messages may wait in Channel before the
+// subscriber stops reading from the server.
+const messageBuffer = 100
+
+// PubSub is a set of channel and pattern subscriptions on a connection of its
+// own, so receiving messages never competes with commands sent on other clients.
+// Messages from every subscription arrive on Channel. A PubSub is safe for
+// concurrent use.
+//
+// Patterns are glob-style: '*' matches any run of characters, '?' matches one
+// character and [...] matches a character class, so "orders.*" receives
+// messages published to "orders.created" and "orders.paid".
+//
+// When its connection drops, a PubSub reconnects, re-authenticates and restores
+// every subscription, reporting each step through Config.Hooks. It keeps trying,
+// backing off up to Config.Retry.MaxBackoff, until it is closed, unless
+// Config.Retry.MaxAttempts sets a limit. Messages published while it was disconnected
+// are not delivered; OnResubscribe marks the point from which delivery resumed.
+//
+//	ps, err := tempdb.NewPubSub(config, "chatroom")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer ps.Close()
+//	for msg := range ps.Channel() {
+//		log.Printf("%s: %s", msg.Channel, msg.Payload)
+//	}
+type PubSub struct {
+	client   *TempDBClient
+	messages chan Message
+	retry    RetryPolicy
+
+	ctx    context.Context // ctx is cancelled by Close, aborting any reconnect in progress.
+	cancel context.CancelFunc
+	connMu sync.Mutex // connMu is held while the connection is being replaced or closed.
+
+	mu       sync.Mutex
+	channels map[string]bool
+	patterns map[string]bool
+	closed   bool
+	err      error       // err is why Channel was closed, if not by Close.
+	stop     func() bool // stop detaches the PubSub from the context it was created with.
+}
+
+// NewPubSub dials a dedicated connection for config and subscribes it to channels.
+func NewPubSub(config Config, channels ...string) (*PubSub, error) {
+	return NewPubSubContext(context.Background(), config, channels...)
+}
+
+// NewPubSubContext is like NewPubSub but uses ctx for dialing, authentication and
+// the initial subscriptions. The PubSub is closed when ctx is done.
+func NewPubSubContext(ctx context.Context, config Config, channels ...string) (*PubSub, error) {
+	// A dropped connection loses its subscriptions, so commands must not redial it
+	// behind the subscriber's back; the subscriber reconnects and resubscribes itself.
+	retry := config.Retry
+	config.Retry.MaxAttempts = -1
+	client, err := createClient(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &PubSub{
+		client:   client,
+		messages: make(chan Message, messageBuffer),
+		retry:    retry,
+		channels: map[string]bool{},
+		patterns: map[string]bool{},
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	// Start receiving before subscribing so messages pushed straight after the reply are not missed.
+	go p.receive(client.conn.pushChannel())
+
+	if err := p.SubscribeContext(ctx, channels...); err != nil {
+		p.Close()
+		return nil, err
+	}
+	p.mu.Lock()
+	p.stop = context.AfterFunc(ctx, func() { p.Close() })
+	p.mu.Unlock()
+	return p, nil
+}
+
+// receive forwards pushed messages to Channel, reconnecting whenever the
+// connection fails, until the PubSub is closed or cannot reconnect. It then
+// closes Channel.
+func (p *PubSub) receive(pushes <-chan string) {
+	defer close(p.messages)
+	for pushes != nil {
+		for push := range pushes {
+			select {
+			case p.messages <- parseMessage(push):
+			case <-p.ctx.Done():
+				return
+			}
+		}
+		pushes = p.recover()
+	}
+}
+
+// recover replaces a failed connection, retrying with backoff until the PubSub is
+// closed or the attempts set by the retry policy run out, and returns the new
+// connection's pushes. It returns nil if the PubSub was closed or gave up.
+func (p *PubSub) recover() <-chan string {
+	if p.ctx.Err() != nil {
+		return nil
+	}
+	c := p.client
+	hooks := c.config.Hooks
+	cause := c.conn.Err()
+	if hooks != nil && hooks.OnDisconnect != nil {
+		hooks.OnDisconnect(c.addr, cause)
+	}
+
+	// Unlike a command, a subscriber has no caller to report to, so by default it
+	// never gives up.
+	unlimited, attempts := p.retry.MaxAttempts == 0, max(p.retry.MaxAttempts, 0)
+	err := cause
+	for attempt := 1; unlimited || attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			if sleepContext(p.ctx, p.retry.backoff(attempt-2)) != nil {
+				return nil
+			}
+		}
+
+		var pushes <-chan string
+		if pushes, err = p.resubscribe(); err == nil {
+			if hooks != nil && hooks.OnReconnect != nil {
+				hooks.OnReconnect(c.addr, attempt)
+			}
+			if hooks != nil && hooks.OnResubscribe != nil {
+				hooks.OnResubscribe(c.addr, p.Channels(), p.Patterns())
+			}
+			return pushes
+		}
+		if p.ctx.Err() != nil {
+			return nil
+		}
+		if hooks != nil && hooks.OnReconnectFailed != nil {
+			hooks.OnReconnectFailed(c.addr, attempt, err)
+		}
+	}
+
+	if attempts > 0 {
+		err = fmt.Errorf("reconnect failed after %d attempts: %w", attempts, err)
+	}
+	p.mu.Lock()
+	p.err = err
+	p.mu.Unlock()
+	return nil
+}
+
+// resubscribe dials and authenticates a new connection and restores every
+// subscription on it, returning its pushes.
+func (p *PubSub) resubscribe() (<-chan string, error) {
+	p.connMu.Lock()
+	defer p.connMu.Unlock()
+
+	c := p.client
+	if err := c.lock(p.ctx); err != nil {
+		return nil, err
+	}
+	defer c.unlock()
+
+	if err := c.reconnect(p.ctx); err != nil {
+		return nil, err
+	}
+	pushes := c.conn.pushChannel()
+
+	restore := func(name string, names []string) error {
+		for _, n := range names {
+			command, err := newCommand(name).key(n).build()
+			if err != nil {
+				return err
+			}
+			respBytes, err := c.conn.roundTrip(p.ctx, c.commandLine(command))
+			if err == nil {
+				_, err = parseResponse(command, respBytes)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to restore subscription to %s: %w", n, err)
+			}
+		}
+		return nil
+	}
+	if err := restore("SUBSCRIBE", p.Channels()); err != nil {
+		c.conn.Close()
+		return nil, err
+	}
+	if err := restore("PSUBSCRIBE", p.Patterns()); err != nil {
+		c.conn.Close()
+		return nil, err
+	}
+	return pushes, nil
+}
+
+// Channel returns the channel on which messages are delivered. It is closed when
+// the PubSub is closed or its connection fails and cannot be restored.
+func (p *PubSub) Channel() <-chan Message {
+	return p.messages
+}
+
+// Err returns why Channel was closed when it was not closed by Close, or nil.
+func (p *PubSub) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// Channels returns the subscribed channel names in sorted order.
+func (p *PubSub) Channels() []string {
+	return p.names(p.channels)
+}
+
+// Patterns returns the subscribed patterns in sorted order.
+func (p *PubSub) Patterns() []string {
+	return p.names(p.patterns)
+}
+
+func (p *PubSub) names(set map[string]bool) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Subscribe adds channels to the subscription.
+func (p *PubSub) Subscribe(channels ...string) error {
+	return p.SubscribeContext(context.Background(), channels...)
+}
+
+// SubscribeContext is like Subscribe but honours ctx. Channels subscribed before
+// an error remain subscribed.
+func (p *PubSub) SubscribeContext(ctx context.Context, channels ...string) error {
+	return p.update(ctx, "SUBSCRIBE", p.channels, true, channels)
+}
+
+// Unsubscribe removes channels from the subscription.
+func (p *PubSub) Unsubscribe(channels ...string) error {
+	return p.UnsubscribeContext(context.Background(), channels...)
+}
+
+// UnsubscribeContext is like Unsubscribe but honours ctx.
+func (p *PubSub) UnsubscribeContext(ctx context.Context, channels ...string) error {
+	return p.update(ctx, "UNSUBSCRIBE", p.channels, false, channels)
+}
+
+// PSubscribe adds patterns to the subscription. Each message published to a
+// matching channel arrives once per matching pattern, with Message.Pattern set.
+func (p *PubSub) PSubscribe(patterns ...string) error {
+	return p.PSubscribeContext(context.Background(), patterns...)
+}
+
+// PSubscribeContext is like PSubscribe but honours ctx. Patterns subscribed before
+// an error remain subscribed.
+func (p *PubSub) PSubscribeContext(ctx context.Context, patterns ...string) error {
+	return p.update(ctx, "PSUBSCRIBE", p.patterns, true, patterns)
+}
+
+// PUnsubscribe removes patterns from the subscription.
+func (p *PubSub) PUnsubscribe(patterns ...string) error {
+	return p.PUnsubscribeContext(context.Background(), patterns...)
+}
+
+// PUnsubscribeContext is like PUnsubscribe but honours ctx.
+func (p *PubSub) PUnsubscribeContext(ctx context.Context, patterns ...string) error {
+	return p.update(ctx, "PUNSUBSCRIBE", p.patterns, false, patterns)
+}
+
+// update sends the subscription command name for each of names, recording in set
+// which of them are subscribed. The client lock is held until set is updated, so
+// resubscribe restores either none or all of the effect of each command.
+func (p *PubSub) update(ctx context.Context, name string, set map[string]bool, subscribed bool, names []string) error {
+	c := p.client
+	if err := c.lock(ctx); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	for _, n := range names {
+		p.mu.Lock()
+		closed := p.closed
+		p.mu.Unlock()
+		if closed {
+			return ErrConnectionClosed
+		}
+
+		command, err := newCommand(name).key(n).build()
+		if err != nil {
+			return err
+		}
+		respBytes, err := c.conn.roundTrip(ctx, c.commandLine(command))
+		if err == nil {
+			_, err = parseResponse(command, respBytes)
+		}
+		if err != nil {
+			return err
+		}
+
+		p.mu.Lock()
+		if subscribed {
+			set[n] = true
+		} else {
+			delete(set, n)
+		}
+		p.mu.Unlock()
+	}
+	return nil
+}
+
+// Close closes the connection, ending every subscription. Channel is closed once
+// any message being delivered has been abandoned. Close is safe to call more than once.
+func (p *PubSub) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	stop := p.stop
+	p.mu.Unlock()
+
+	if stop != nil {
+		stop()
+	}
+	p.cancel()
+	p.connMu.Lock()
+	p.client.conn.Close()
+	p.connMu.Unlock()
+	return nil
+}
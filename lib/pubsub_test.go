@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPubSubCloseWithUnreadMessages(t *testing.T) {
+	s := newFakeServer(t, func(fc *fakeConn, command string) {
+		fc.ok()
+		if strings.HasPrefix(command, "SUBSCRIBE ") {
+			// Far more than the message and push buffers hold, so the reader blocks.
+			for range 1000 {
+				fc.send("MSG chat hello")
+			}
+		}
+	})
+	ps, err := NewPubSub(s.config(), "chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		ps.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close blocked on unread messages")
+	}
+	for range ps.Channel() {
+	}
+}
+
+func TestPubSubResubscribesAfterDrop(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		first *fakeConn
+	)
+	restored := make(chan string, 10)
+	s := newFakeServer(t, func(fc *fakeConn, command string) {
+		mu.Lock()
+		if first == nil {
+			first = fc
+		}
+		reconnected := fc != first
+		mu.Unlock()
+		if reconnected {
+			restored <- command
+		}
+		fc.ok()
+	})
+	ps, err := NewPubSub(s.config(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps.Close()
+	if err := ps.PSubscribe("b.*"); err != nil {
+		t.Fatal(err)
+	}
+	s.dropAll()
+
+	var got []string
+	for len(got) < 2 {
+		select {
+		case command := <-restored:
+			got = append(got, command)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("restored %q, want SUBSCRIBE a and PSUBSCRIBE b.*", got)
+		}
+	}
+	if got[0] != "SUBSCRIBE a" || got[1] != "PSUBSCRIBE b.*" {
+		t.Fatalf("restored %q, want SUBSCRIBE a and PSUBSCRIBE b.*", got)
+	}
+}
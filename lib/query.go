@@ -1,13 +1,16 @@
 package lib
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"unicode/utf8"
 )
 
 type QueryBuilder struct {
 	operations []string
+	err        error // err records the first field or value that cannot be encoded.
 }
 
 func NewQuery() *QueryBuilder {
@@ -20,47 +23,47 @@ func (ab *QueryBuilder) Count() *QueryBuilder {
 }
 
 func (ab *QueryBuilder) Sum(field string) *QueryBuilder {
-	ab.operations = append(ab.operations, fmt.Sprintf("SUM /%s", field))
+	ab.operations = append(ab.operations, fmt.Sprintf("SUM %s", ab.path(field)))
 	return ab
 }
 
 func (ab *QueryBuilder) Average(field string) *QueryBuilder {
-	ab.operations = append(ab.operations, fmt.Sprintf("AVG /%s", field))
+	ab.operations = append(ab.operations, fmt.Sprintf("AVG %s", ab.path(field)))
 	return ab
 }
 
 func (ab *QueryBuilder) GroupBy(field string) *QueryBuilder {
-	ab.operations = append(ab.operations, fmt.Sprintf("GROUPBY /%s", field))
+	ab.operations = append(ab.operations, fmt.Sprintf("GROUPBY %s", ab.path(field)))
 	return ab
 }
 
 func (ab *QueryBuilder) Filter(field, operator, value string) *QueryBuilder {
-	ab.operations = append(ab.operations, fmt.Sprintf("FILTER /%s %s %s", field, operator, value))
+	ab.operations = append(ab.operations, fmt.Sprintf("FILTER %s %s %s", ab.path(field), ab.ident(operator), ab.value(value)))
 	return ab
 }
 
 func (qb *QueryBuilder) Min(field string) *QueryBuilder {
-	qb.operations = append(qb.operations, fmt.Sprintf("MIN /%s", field))
+	qb.operations = append(qb.operations, fmt.Sprintf("MIN %s", qb.path(field)))
 	return qb
 }
 
 func (qb *QueryBuilder) Max(field string) *QueryBuilder {
-	qb.operations = append(qb.operations, fmt.Sprintf("MAX /%s", field))
+	qb.operations = append(qb.operations, fmt.Sprintf("MAX %s", qb.path(field)))
 	return qb
 }
 
 func (qb *QueryBuilder) Distinct(field string) *QueryBuilder {
-	qb.operations = append(qb.operations, fmt.Sprintf("DISTINCT /%s", field))
+	qb.operations = append(qb.operations, fmt.Sprintf("DISTINCT %s", qb.path(field)))
 	return qb
 }
 
 func (qb *QueryBuilder) TopN(n int, field string) *QueryBuilder {
-	qb.operations = append(qb.operations, fmt.Sprintf("TOPN %d /%s", n, field))
+	qb.operations = append(qb.operations, fmt.Sprintf("TOPN %d %s", n, qb.path(field)))
 	return qb
 }
 
 func (qb *QueryBuilder) BottomN(n int, field string) *QueryBuilder {
-	qb.operations = append(qb.operations, fmt.Sprintf("BOTTOMN %d /%s", n, field))
+	qb.operations = append(qb.operations, fmt.Sprintf("BOTTOMN %d %s", n, qb.path(field)))
 	return qb
 }
 
@@ -119,23 +122,66 @@ func (ab *QueryBuilder) Build() string {
 	return strings.Join(ab.operations, " ")
 }
 
+// Err returns the first field, key or value passed to the builder that cannot be
+// encoded in a query, or nil.
+func (qb *QueryBuilder) Err() error {
+	return qb.err
+}
+
+// ident encodes a key or operator, recording an error if it is not a valid identifier.
+func (qb *QueryBuilder) ident(s string) string {
+	if reason := invalidKey(s); reason != "" && qb.err == nil {
+		qb.err = &ArgumentError{Command: "QUERY", Arg: s, Reason: reason}
+	}
+	return quoteArg(s)
+}
+
+// path encodes a field as a /field path.
+func (qb *QueryBuilder) path(field string) string {
+	if reason := invalidKey(field); reason != "" && qb.err == nil {
+		qb.err = &ArgumentError{Command: "QUERY", Arg: field, Reason: reason}
+	}
+	return quoteArg("/" + field)
+}
+
+// value encodes a filter operand.
+func (qb *QueryBuilder) value(v string) string {
+	if !utf8.ValidString(v) && qb.err == nil {
+		qb.err = &ArgumentError{Command: "QUERY", Arg: v, Reason: "value is not valid UTF-8"}
+	}
+	return quoteArg(v)
+}
+
 func (c *TempDBClient) Query(pipeline string) (interface{}, error) {
-	return c.sendCommand(fmt.Sprintf("QUERY %s", pipeline))
+	return c.QueryContext(context.Background(), pipeline)
+}
+
+// QueryContext is like Query but honours ctx.
+func (c *TempDBClient) QueryContext(ctx context.Context, pipeline string) (interface{}, error) {
+	return c.do(ctx, rawCommand("QUERY", pipeline))
 }
 
 func (c *TempDBClient) QueryWithBuilder(builder *QueryBuilder) (interface{}, error) {
-	return c.Query(builder.Build())
+	return c.QueryWithBuilderContext(context.Background(), builder)
+}
+
+// QueryWithBuilderContext is like QueryWithBuilder but honours ctx.
+func (c *TempDBClient) QueryWithBuilderContext(ctx context.Context, builder *QueryBuilder) (interface{}, error) {
+	if err := builder.Err(); err != nil {
+		return nil, err
+	}
+	return c.QueryContext(ctx, builder.Build())
 }
 
 // Median calculates the median value of a numeric field
 func (qb *QueryBuilder) Median(field string) *QueryBuilder {
-	qb.operations = append(qb.operations, fmt.Sprintf("MEDIAN /%s", field))
+	qb.operations = append(qb.operations, fmt.Sprintf("MEDIAN %s", qb.path(field)))
 	return qb
 }
 
 // StdDev calculates the standard deviation of a numeric field
 func (qb *QueryBuilder) StdDev(field string) *QueryBuilder {
-	qb.operations = append(qb.operations, fmt.Sprintf("STDDEV /%s", field))
+	qb.operations = append(qb.operations, fmt.Sprintf("STDDEV %s", qb.path(field)))
 	return qb
 }
 
@@ -145,13 +191,13 @@ func (qb *QueryBuilder) Sort(field, direction string) *QueryBuilder {
 	if direction != "asc" && direction != "desc" {
 		direction = "asc" // Default to ascending if invalid
 	}
-	qb.operations = append(qb.operations, fmt.Sprintf("SORT /%s %s", field, direction))
+	qb.operations = append(qb.operations, fmt.Sprintf("SORT %s %s", qb.path(field), direction))
 	return qb
 }
 
 // Join combines data from another key with matching fields
 func (qb *QueryBuilder) Join(sourceKey, sourceField, targetField string) *QueryBuilder {
-	qb.operations = append(qb.operations, fmt.Sprintf("JOIN %s /%s /%s", sourceKey, sourceField, targetField))
+	qb.operations = append(qb.operations, fmt.Sprintf("JOIN %s %s %s", qb.ident(sourceKey), qb.path(sourceField), qb.path(targetField)))
 	return qb
 }
 
@@ -0,0 +1,285 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// poppedMessage is the wire form of a message removed by a blocking dequeue.
+type poppedMessage struct {
+	Queue   string          `json:"queue"`
+	Message json.RawMessage `json:"message"`
+}
+
+// DequeueBlocking removes and returns the next message from a queue, waiting up
+// to timeout for one to arrive. The server replies as soon as a message is
+// enqueued, so no polling is involved. It returns ErrQueueTimeout if the queue
+// stayed empty; a timeout of 0 waits indefinitely.
+//
+// DequeueBlocking is a blocking command, as are DequeueBlockingAny,
+// DequeueLeaseBlocking and XReadBlocking: it holds the client's connection while
+// the server waits, so no other command can use the client until it returns. Run
+// blocking commands on a client of their own.
+func (c *TempDBClient) DequeueBlocking(queueKey string, timeout time.Duration) (interface{}, error) {
+	return c.DequeueBlockingContext(context.Background(), queueKey, timeout)
+}
+
+// DequeueBlockingContext is like DequeueBlocking but honours ctx, which may end
+// the wait before timeout: the server stops waiting by ctx's deadline. If ctx is
+// cancelled while waiting, the connection is closed so the server stops waiting
+// too, rather than later removing a message nobody reads; the client reconnects
+// on its next command.
+func (c *TempDBClient) DequeueBlockingContext(ctx context.Context, queueKey string, timeout time.Duration) (interface{}, error) {
+	_, message, err := c.DequeueBlockingAnyContext(ctx, timeout, queueKey)
+	return message, err
+}
+
+// DequeueBlockingAny waits up to timeout for a message on any of queueKeys and
+// returns the message together with the queue it was removed from. Queues are
+// checked in the order given, so earlier queues take precedence when several
+// have messages. It returns ErrQueueTimeout if every queue stayed empty.
+func (c *TempDBClient) DequeueBlockingAny(timeout time.Duration, queueKeys ...string) (string, interface{}, error) {
+	return c.DequeueBlockingAnyContext(context.Background(), timeout, queueKeys...)
+}
+
+// DequeueBlockingAnyContext is like DequeueBlockingAny but honours ctx.
+func (c *TempDBClient) DequeueBlockingAnyContext(ctx context.Context, timeout time.Duration, queueKeys ...string) (string, interface{}, error) {
+	popped, err := c.dequeueBlocking(ctx, timeout, queueKeys)
+	if err != nil {
+		return "", nil, err
+	}
+	message, err := decodeResponseData(ResponseData{Type: TypeJson, Data: popped.Message})
+	if err != nil {
+		return "", nil, err
+	}
+	return popped.Queue, message, nil
+}
+
+// DequeueBlockingAs is like DequeueBlocking but decodes the message into a T.
+func DequeueBlockingAs[T any](c *TempDBClient, queueKey string, timeout time.Duration) (T, error) {
+	return DequeueBlockingAsContext[T](context.Background(), c, queueKey, timeout)
+}
+
+// DequeueBlockingAsContext is like DequeueBlockingAs but honours ctx.
+func DequeueBlockingAsContext[T any](ctx context.Context, c *TempDBClient, queueKey string, timeout time.Duration) (T, error) {
+	popped, err := c.dequeueBlocking(ctx, timeout, []string{queueKey})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return decodeAs[T](ResponseData{Type: TypeJson, Data: popped.Message})
+}
+
+// dequeueBlocking sends a BDEQUEUE for queueKeys. The server reports a timeout
+// either as a Null reply or as an error matching ErrQueueTimeout.
+func (c *TempDBClient) dequeueBlocking(ctx context.Context, timeout time.Duration, queueKeys []string) (poppedMessage, error) {
+	cb := newCommand("BDEQUEUE").int(millis(blockingTimeout(ctx, timeout)))
+	for _, queueKey := range queueKeys {
+		cb.key(queueKey)
+	}
+	responseData, err := c.doBlocking(ctx, cb)
+	if err != nil {
+		return poppedMessage{}, err
+	}
+	if responseData.Type == TypeNull {
+		return poppedMessage{}, ErrQueueTimeout
+	}
+	return decodeAs[poppedMessage](responseData)
+}
+
+// EnqueueAt adds a message to a queue that only becomes visible to consumers at
+// deliverAt. Until then it is counted as scheduled by QCounts and is skipped by
+// Dequeue and QPeek.
+func (c *TempDBClient) EnqueueAt(queueKey string, message interface{}, deliverAt time.Time) error {
+	return c.EnqueueAtContext(context.Background(), queueKey, message, deliverAt)
+}
+
+// EnqueueAtContext is like EnqueueAt but honours ctx.
+func (c *TempDBClient) EnqueueAtContext(ctx context.Context, queueKey string, message interface{}, deliverAt time.Time) error {
+	_, err := c.do(ctx, newCommand("ENQUEUE_AT").key(queueKey).int64(deliverAt.UnixMilli()).json(message))
+	return err
+}
+
+// EnqueueAfter adds a message to a queue that only becomes visible to consumers
+// once delay has passed.
+func (c *TempDBClient) EnqueueAfter(queueKey string, message interface{}, delay time.Duration) error {
+	return c.EnqueueAfterContext(context.Background(), queueKey, message, delay)
+}
+
+// EnqueueAfterContext is like EnqueueAfter but honours ctx.
+func (c *TempDBClient) EnqueueAfterContext(ctx context.Context, queueKey string, message interface{}, delay time.Duration) error {
+	return c.EnqueueAtContext(ctx, queueKey, message, time.Now().Add(delay))
+}
+
+// EnqueuePriority adds a message to a queue with the given priority. Dequeue
+// returns messages with a higher priority first and messages of equal priority
+// in the order they were enqueued. Enqueue uses priority 0, so negative
+// priorities wait behind ordinary messages.
+func (c *TempDBClient) EnqueuePriority(queueKey string, message interface{}, priority int) error {
+	return c.EnqueuePriorityContext(context.Background(), queueKey, message, priority)
+}
+
+// EnqueuePriorityContext is like EnqueuePriority but honours ctx.
+func (c *TempDBClient) EnqueuePriorityContext(ctx context.Context, queueKey string, message interface{}, priority int) error {
+	_, err := c.do(ctx, newCommand("ENQUEUE_PRI").key(queueKey).int(priority).json(message))
+	return err
+}
+
+// QueueCounts breaks down the messages in a queue.
+type QueueCounts struct {
+	Ready      int         `json:"ready"`       // Ready messages can be dequeued now.
+	Scheduled  int         `json:"scheduled"`   // Scheduled messages were enqueued with EnqueueAt or EnqueueAfter and are not yet due.
+	ByPriority map[int]int `json:"by_priority"` // ByPriority counts the ready messages at each priority level.
+}
+
+// QCounts returns how many messages in a queue are ready, how many are
+// scheduled, and how the ready messages are spread across priorities.
+func (c *TempDBClient) QCounts(queueKey string) (QueueCounts, error) {
+	return c.QCountsContext(context.Background(), queueKey)
+}
+
+// QCountsContext is like QCounts but honours ctx.
+func (c *TempDBClient) QCountsContext(ctx context.Context, queueKey string) (QueueCounts, error) {
+	responseData, err := c.doRaw(ctx, newCommand("QCOUNTS").key(queueKey))
+	if err != nil {
+		return QueueCounts{}, err
+	}
+	return decodeAs[QueueCounts](responseData)
+}
+
+// ScheduledMessage is a message that is not yet due for delivery.
+type ScheduledMessage struct {
+	Message   interface{} // Message is the message as Dequeue will return it.
+	DeliverAt time.Time   // DeliverAt is when the message becomes visible.
+}
+
+// scheduledMessage is the wire form of a ScheduledMessage.
+type scheduledMessage struct {
+	Message   json.RawMessage `json:"message"`
+	DeliverAt int64           `json:"deliver_at"`
+}
+
+// QPeekScheduled returns the scheduled message that will become visible next,
+// without removing it. It returns ErrEmptyQueue if nothing is scheduled.
+func (c *TempDBClient) QPeekScheduled(queueKey string) (*ScheduledMessage, error) {
+	return c.QPeekScheduledContext(context.Background(), queueKey)
+}
+
+// QPeekScheduledContext is like QPeekScheduled but honours ctx.
+func (c *TempDBClient) QPeekScheduledContext(ctx context.Context, queueKey string) (*ScheduledMessage, error) {
+	responseData, err := c.doRaw(ctx, newCommand("QPEEK_SCHEDULED").key(queueKey))
+	if err != nil {
+		return nil, err
+	}
+	if responseData.Type == TypeNull {
+		return nil, ErrEmptyQueue
+	}
+	raw, err := decodeAs[scheduledMessage](responseData)
+	if err != nil {
+		return nil, err
+	}
+	message, err := decodeResponseData(ResponseData{Type: TypeJson, Data: raw.Message})
+	if err != nil {
+		return nil, err
+	}
+	return &ScheduledMessage{Message: message, DeliverAt: time.UnixMilli(raw.DeliverAt)}, nil
+}
+
+// QueuedMessage is a message removed from a queue by DequeueN.
+type QueuedMessage struct {
+	ID      string      // ID identifies the message within its queue.
+	Message interface{} // Message is the message as Dequeue would return it.
+}
+
+// queuedMessage is the wire form of a QueuedMessage.
+type queuedMessage struct {
+	ID      string          `json:"id"`
+	Message json.RawMessage `json:"message"`
+}
+
+// EnqueueBatch adds messages to a queue in order with a single command, so
+// either all of them are enqueued or none are. It returns the ID given to each
+// message, in the same order.
+func (c *TempDBClient) EnqueueBatch(queueKey string, messages []interface{}) ([]string, error) {
+	return c.EnqueueBatchContext(context.Background(), queueKey, messages)
+}
+
+// EnqueueBatchContext is like EnqueueBatch but honours ctx.
+func (c *TempDBClient) EnqueueBatchContext(ctx context.Context, queueKey string, messages []interface{}) ([]string, error) {
+	if len(messages) == 0 {
+		return nil, nil
+	}
+	responseData, err := c.doRaw(ctx, newCommand("ENQUEUE_BATCH").key(queueKey).json(messages))
+	if err != nil {
+		return nil, err
+	}
+	ids, err := decodeAs[[]string](responseData)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) != len(messages) {
+		return ids, fmt.Errorf("unexpected response: %d IDs for %d messages", len(ids), len(messages))
+	}
+	return ids, nil
+}
+
+// DequeueN removes and returns up to n messages from a queue with a single
+// command, in the order Dequeue would return them. It returns an empty slice
+// rather than ErrEmptyQueue when the queue is empty.
+func (c *TempDBClient) DequeueN(queueKey string, n int) ([]QueuedMessage, error) {
+	return c.DequeueNContext(context.Background(), queueKey, n)
+}
+
+// DequeueNContext is like DequeueN but honours ctx.
+func (c *TempDBClient) DequeueNContext(ctx context.Context, queueKey string, n int) ([]QueuedMessage, error) {
+	raw, err := c.dequeueN(ctx, queueKey, n)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]QueuedMessage, len(raw))
+	for i, m := range raw {
+		message, err := decodeResponseData(ResponseData{Type: TypeJson, Data: m.Message})
+		if err != nil {
+			return nil, err
+		}
+		messages[i] = QueuedMessage{ID: m.ID, Message: message}
+	}
+	return messages, nil
+}
+
+// DequeueNAs is like DequeueN but decodes each message into a T.
+func DequeueNAs[T any](c *TempDBClient, queueKey string, n int) ([]T, error) {
+	return DequeueNAsContext[T](context.Background(), c, queueKey, n)
+}
+
+// DequeueNAsContext is like DequeueNAs but honours ctx.
+func DequeueNAsContext[T any](ctx context.Context, c *TempDBClient, queueKey string, n int) ([]T, error) {
+	raw, err := c.dequeueN(ctx, queueKey, n)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]T, len(raw))
+	for i, m := range raw {
+		if values[i], err = decodeAs[T](ResponseData{Type: TypeJson, Data: m.Message}); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (c *TempDBClient) dequeueN(ctx context.Context, queueKey string, n int) ([]queuedMessage, error) {
+	if n <= 0 {
+		return []queuedMessage{}, nil
+	}
+	responseData, err := c.doRaw(ctx, newCommand("DEQUEUE_N").key(queueKey).int(n))
+	if errors.Is(err, ErrEmptyQueue) || err == nil && responseData.Type == TypeNull {
+		return []queuedMessage{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeAs[[]queuedMessage](responseData)
+}
@@ -0,0 +1,65 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCancelledBlockingDequeueIsNotPooled(t *testing.T) {
+	s := newFakeServer(t, func(fc *fakeConn, command string) {
+		if strings.HasPrefix(command, "BDEQUEUE ") {
+			return // Hold the dequeue until the connection is closed.
+		}
+		fc.reply(TypeString, "PONG")
+	})
+	client, err := NewClient(s.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := client.DequeueBlockingContext(ctx, "tasks", 0); !errors.Is(err, context.Canceled) {
+		t.Fatalf("DequeueBlocking returned %v, want context.Canceled", err)
+	}
+	client.Close()
+
+	next, err := NewClient(s.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer next.Close()
+	if next == client {
+		t.Fatal("client with an abandoned blocking dequeue was returned to the pool")
+	}
+}
+
+func TestBlockingTimeoutCappedAtDeadline(t *testing.T) {
+	commands := make(chan string, 1)
+	s := newFakeServer(t, func(fc *fakeConn, command string) {
+		commands <- command
+		fc.reply(TypeNull, nil)
+	})
+	client, err := NewClient(s.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := client.DequeueBlockingContext(ctx, "tasks", time.Minute); !errors.Is(err, ErrQueueTimeout) {
+		t.Fatalf("DequeueBlocking returned %v, want ErrQueueTimeout", err)
+	}
+	var timeout int
+	if _, err := fmt.Sscanf(<-commands, "BDEQUEUE %d tasks", &timeout); err != nil {
+		t.Fatal(err)
+	}
+	if timeout <= 0 || timeout > 1000 {
+		t.Fatalf("BDEQUEUE timeout = %dms, want at most the 1s deadline", timeout)
+	}
+}
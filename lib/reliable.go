@@ -0,0 +1,167 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// defaultVisibility is the lease used when DequeueLease is given no visibility timeout.
+const defaultVisibility = 30 * time.Second
+
+// Delivery is a message leased from a queue by DequeueLease. The message stays
+// in the queue, hidden from other consumers, until it is acknowledged with Ack,
+// handed back with Nack, or its lease expires, after which it is delivered again.
+type Delivery struct {
+	ID             string    // ID identifies this message within its queue.
+	Queue          string    // Queue is the queue the message was leased from.
+	Payload        []byte    // Payload is the message as JSON.
+	Priority       int       // Priority is the priority the message was enqueued with.
+	DeliveryCount  int       // DeliveryCount is how many times the message has been delivered, including this time.
+	LeaseExpiresAt time.Time // LeaseExpiresAt is when the message becomes visible again unless acknowledged.
+
+	client *TempDBClient
+}
+
+// delivery is the wire form of a Delivery.
+type delivery struct {
+	ID             string          `json:"id"`
+	Message        json.RawMessage `json:"message"`
+	Priority       int             `json:"priority"`
+	DeliveryCount  int             `json:"delivery_count"`
+	LeaseExpiresAt int64           `json:"lease_expires_at"`
+}
+
+// DequeueLease leases the next message from a queue for visibility, 30s if zero.
+// Unlike Dequeue it does not remove the message: a consumer that crashes before
+// calling Ack leaves it to be redelivered once the lease expires. It returns
+// ErrEmptyQueue if no message is visible.
+func (c *TempDBClient) DequeueLease(queueKey string, visibility time.Duration) (*Delivery, error) {
+	return c.DequeueLeaseContext(context.Background(), queueKey, visibility)
+}
+
+// DequeueLeaseContext is like DequeueLease but honours ctx.
+func (c *TempDBClient) DequeueLeaseContext(ctx context.Context, queueKey string, visibility time.Duration) (*Delivery, error) {
+	if visibility <= 0 {
+		visibility = defaultVisibility
+	}
+	responseData, err := c.doRaw(ctx, newCommand("QLEASE").key(queueKey).int(millis(visibility)))
+	if err != nil {
+		return nil, err
+	}
+	if responseData.Type == TypeNull {
+		return nil, ErrEmptyQueue
+	}
+	return c.newDelivery(queueKey, responseData)
+}
+
+// DequeueLeaseBlocking is like DequeueLease but waits up to timeout for a message
+// to become visible, returning ErrQueueTimeout if none does; a timeout of 0 waits
+// indefinitely. Like DequeueBlocking it is a blocking command.
+func (c *TempDBClient) DequeueLeaseBlocking(queueKey string, visibility, timeout time.Duration) (*Delivery, error) {
+	return c.DequeueLeaseBlockingContext(context.Background(), queueKey, visibility, timeout)
+}
+
+// DequeueLeaseBlockingContext is like DequeueLeaseBlocking but honours ctx, which
+// may end the wait before timeout; a cancelled wait closes the connection as
+// DequeueBlockingContext does.
+func (c *TempDBClient) DequeueLeaseBlockingContext(ctx context.Context, queueKey string, visibility, timeout time.Duration) (*Delivery, error) {
+	if visibility <= 0 {
+		visibility = defaultVisibility
+	}
+	cb := newCommand("BQLEASE").int(millis(blockingTimeout(ctx, timeout))).int(millis(visibility)).key(queueKey)
+	responseData, err := c.doBlocking(ctx, cb)
+	if err != nil {
+		return nil, err
+	}
+	if responseData.Type == TypeNull {
+		return nil, ErrQueueTimeout
+	}
+	return c.newDelivery(queueKey, responseData)
+}
+
+// newDelivery decodes the reply to a lease taken on queueKey.
+func (c *TempDBClient) newDelivery(queueKey string, responseData ResponseData) (*Delivery, error) {
+	raw, err := decodeAs[delivery](responseData)
+	if err != nil {
+		return nil, err
+	}
+	return &Delivery{
+		ID:             raw.ID,
+		Queue:          queueKey,
+		Payload:        raw.Message,
+		Priority:       raw.Priority,
+		DeliveryCount:  raw.DeliveryCount,
+		LeaseExpiresAt: time.UnixMilli(raw.LeaseExpiresAt),
+		client:         c,
+	}, nil
+}
+
+// Decode unmarshals the message into v.
+func (d *Delivery) Decode(v interface{}) error {
+	if err := json.Unmarshal(d.Payload, v); err != nil {
+		return fmt.Errorf("failed to decode message %s from %s into %T: %w", d.ID, d.Queue, v, err)
+	}
+	return nil
+}
+
+// Value returns the message decoded as Dequeue would return it.
+func (d *Delivery) Value() (interface{}, error) {
+	return decodeResponseData(ResponseData{Type: TypeJson, Data: d.Payload})
+}
+
+// Ack acknowledges the message, removing it from the queue for good. It returns
+// ErrNotFound if the lease had already expired and the message was redelivered.
+func (d *Delivery) Ack() error {
+	return d.AckContext(context.Background())
+}
+
+// AckContext is like Ack but honours ctx.
+func (d *Delivery) AckContext(ctx context.Context) error {
+	_, err := d.client.do(ctx, newCommand("QACK").key(d.Queue).key(d.ID))
+	return err
+}
+
+// Nack ends the lease early, making the message visible to consumers again. The
+// delivery counts as failed for the queue's DeadLetterPolicy.
+func (d *Delivery) Nack() error {
+	return d.NackContext(context.Background())
+}
+
+// NackContext is like Nack but honours ctx.
+func (d *Delivery) NackContext(ctx context.Context) error {
+	_, err := d.client.do(ctx, newCommand("QNACK").key(d.Queue).key(d.ID))
+	return err
+}
+
+// Reject is like Nack but records reason as the message's last error, which is
+// kept with the message if it is moved to a dead-letter queue.
+func (d *Delivery) Reject(reason error) error {
+	return d.RejectContext(context.Background(), reason)
+}
+
+// RejectContext is like Reject but honours ctx.
+func (d *Delivery) RejectContext(ctx context.Context, reason error) error {
+	cb := newCommand("QNACK").key(d.Queue).key(d.ID)
+	if reason != nil {
+		cb.value(reason.Error())
+	}
+	_, err := d.client.do(ctx, cb)
+	return err
+}
+
+// Extend pushes the lease out to visibility from now, for work that takes longer
+// than the visibility timeout it was leased with.
+func (d *Delivery) Extend(visibility time.Duration) error {
+	return d.ExtendContext(context.Background(), visibility)
+}
+
+// ExtendContext is like Extend but honours ctx.
+func (d *Delivery) ExtendContext(ctx context.Context, visibility time.Duration) error {
+	if _, err := d.client.do(ctx, newCommand("QEXTEND").key(d.Queue).key(d.ID).int(millis(visibility))); err != nil {
+		return err
+	}
+	d.LeaseExpiresAt = time.Now().Add(visibility)
+	return nil
+}
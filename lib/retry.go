@@ -0,0 +1,212 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+const (
+	defaultReconnectAttempts = 3
+	defaultMinBackoff        = 100 * time.Millisecond
+	defaultMaxBackoff        = 5 * time.Second
+)
+
+// RetryPolicy controls how a client recovers when its connection drops. The zero
+// value makes up to 3 reconnect attempts per command, backing off exponentially
+// from 100ms to 5s with full jitter, and only retries idempotent commands.
+type RetryPolicy struct {
+	MaxAttempts        int           // MaxAttempts bounds reconnect attempts per command, including those made to resend it, or per disconnect of a PubSub; 0 means 3 for a command and no limit for a PubSub, negative disables reconnecting.
+	MinBackoff         time.Duration // MinBackoff is the delay before the second attempt; 0 means 100ms.
+	MaxBackoff         time.Duration // MaxBackoff caps the delay between attempts; 0 means 5s.
+	RetryNonIdempotent bool          // RetryNonIdempotent also resends commands such as ENQUEUE or XADD, which may then be applied twice.
+}
+
+// Hooks observe a client's connection lifecycle. Any field may be nil. Hooks run
+// synchronously on the goroutine issuing the command, or on the receiving
+// goroutine of a PubSub, and must not block.
+type Hooks struct {
+	OnDisconnect      func(addr string, err error)              // OnDisconnect is called when a broken connection is detected.
+	OnReconnect       func(addr string, attempt int)            // OnReconnect is called after a successful reconnect and re-authentication.
+	OnReconnectFailed func(addr string, attempt int, err error) // OnReconnectFailed is called after each failed reconnect attempt.
+
+	// OnResubscribe is called after a PubSub has restored its subscriptions on a
+	// new connection; messages published since OnDisconnect were not received.
+	OnResubscribe func(addr string, channels, patterns []string)
+}
+
+// idempotentCommands are safe to send again when the connection fails before
+// their reply arrives: repeating them does not change the outcome.
+var idempotentCommands = map[string]bool{
+	"PING":         true,
+	"GET_KEY":      true,
+	"Get_All_KV":   true,
+	"GET_FIELD":    true,
+	"SET":          true,
+	"SETEX":        true,
+	"STORE":        true,
+	"Batch":        true,
+	"DELETE_KEY":   true,
+	"VIEW_LOGS":    true,
+	"GET_DOC":      true,
+	"GET_ALL_DOCS": true,
+	"UPDATE_DOC":   true,
+	"DELETE_DOC":   true,
+	"QUERY_DOCS":   true,
+	"QUERY":        true,
+	"XREAD":        true,
+	"XLIST":        true,
+	"XDEL":         true,
+	"XACK":         true,
+	"XRANGE":       true,
+	"XREVRANGE":    true,
+	"XLEN":         true,
+	"XDEL_ENTRIES": true,
+	"XTRIM":        true,
+	"XPENDING":     true,
+	"QPEEK":        true,
+	"QLEN":         true,
+	"QACK":         true,
+	"QEXTEND":      true,
+	"QCOUNTS":      true,
+	"QDLQ":         true,
+	"QDLQ_REMOVE":  true,
+	"QDLQ_LIST":    true,
+	"QDLQ_PURGE":   true,
+	"QLIST":        true,
+	"CHANS":        true,
+	"CHANS_SUBS":   true,
+	"PUBSUB_ALL":   true,
+	"QUEUES_ALL":   true,
+	"STREAMS_ALL":  true,
+	"VGet":         true,
+	"VSearch":      true,
+	"VSet":         true,
+}
+
+// commandName returns the command keyword at the start of command.
+func commandName(command string) string {
+	name, _, _ := strings.Cut(command, " ")
+	return name
+}
+
+func (p RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts == 0 {
+		return defaultReconnectAttempts
+	}
+	if p.MaxAttempts < 0 {
+		return 0
+	}
+	return p.MaxAttempts
+}
+
+// canResend reports whether command may be sent again after its connection
+// failed with the outcome unknown.
+func (p RetryPolicy) canResend(command string) bool {
+	return p.RetryNonIdempotent || idempotentCommands[commandName(command)]
+}
+
+// backoff returns a random delay in [0, min(MaxBackoff, MinBackoff*2^attempt)).
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	minBackoff, maxBackoff := p.MinBackoff, p.MaxBackoff
+	if minBackoff <= 0 {
+		minBackoff = defaultMinBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+
+	ceiling := maxBackoff
+	if attempt < 32 && minBackoff<<attempt > 0 && minBackoff<<attempt < maxBackoff {
+		ceiling = minBackoff << attempt
+	}
+	return time.Duration(rand.Int64N(int64(ceiling)) + 1)
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ensureConnected replaces a failed connection with a freshly dialed and
+// authenticated one, retrying with backoff as allowed by the retry policy.
+// The caller must hold the lock.
+func (c *TempDBClient) ensureConnected(ctx context.Context) error {
+	_, err := c.ensureConnectedWithin(ctx, c.config.Retry.maxAttempts())
+	return err
+}
+
+// ensureConnectedWithin is like ensureConnected but makes at most attempts
+// reconnect attempts, and returns how many it made so a command that is resent
+// can share one budget across its reconnects.
+func (c *TempDBClient) ensureConnectedWithin(ctx context.Context, attempts int) (int, error) {
+	cause := c.conn.Err()
+	if cause == nil {
+		return 0, nil
+	}
+	if c.closed {
+		return 0, ErrConnectionClosed
+	}
+
+	hooks := c.config.Hooks
+	if hooks != nil && hooks.OnDisconnect != nil {
+		hooks.OnDisconnect(c.addr, cause)
+	}
+	if attempts <= 0 {
+		return 0, cause
+	}
+
+	policy := c.config.Retry
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			if err := sleepContext(ctx, policy.backoff(attempt-2)); err != nil {
+				return attempt - 1, err
+			}
+		}
+
+		if err = c.reconnect(ctx); err == nil {
+			if hooks != nil && hooks.OnReconnect != nil {
+				hooks.OnReconnect(c.addr, attempt)
+			}
+			return attempt, nil
+		}
+		if hooks != nil && hooks.OnReconnectFailed != nil {
+			hooks.OnReconnectFailed(c.addr, attempt, err)
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return attempt, ctxErr
+		}
+	}
+	return attempts, fmt.Errorf("reconnect failed after %d attempts: %w", attempts, err)
+}
+
+// reconnect dials a new connection and re-authenticates, obtaining a new session ID.
+func (c *TempDBClient) reconnect(ctx context.Context) error {
+	dialCtx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+
+	netConn, err := dial(dialCtx, c.config)
+	if err != nil {
+		return fmt.Errorf("connection error: %w", err)
+	}
+
+	previous := c.conn
+	c.conn = newConnection(netConn)
+	if err := c.authenticate(ctx); err != nil {
+		c.conn.Close()
+		c.conn = previous
+		return fmt.Errorf("authentication error: %w", err)
+	}
+	c.createdAt = time.Now()
+	return nil
+}
@@ -0,0 +1,112 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIdempotentCommandResentAfterDrop(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		gets  int
+		conns = map[*fakeConn]bool{}
+	)
+	s := newFakeServer(t, func(fc *fakeConn, command string) {
+		mu.Lock()
+		conns[fc] = true
+		if strings.HasPrefix(command, "GET_KEY") {
+			gets++
+		}
+		first := gets == 1
+		mu.Unlock()
+		if first {
+			fc.conn.Close()
+			return
+		}
+		fc.reply(TypeString, keyOf(command))
+	})
+	config := s.config()
+	config.Retry.MinBackoff = time.Millisecond
+	client, err := createClient(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	got, err := GetAs[string](client, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "a" {
+		t.Fatalf("Get(a) = %q, want %q", got, "a")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if gets != 2 || len(conns) != 2 {
+		t.Fatalf("GET_KEY sent %d times on %d connections, want 2 on 2", gets, len(conns))
+	}
+}
+
+func TestEnqueueNotResentAfterDrop(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		enqueues int
+	)
+	s := newFakeServer(t, func(fc *fakeConn, command string) {
+		if strings.HasPrefix(command, "ENQUEUE") {
+			mu.Lock()
+			enqueues++
+			mu.Unlock()
+		}
+		fc.conn.Close()
+	})
+	client, err := createClient(context.Background(), s.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if err := client.Enqueue("q", "job"); !errors.Is(err, ErrConnectionClosed) {
+		t.Fatalf("Enqueue returned %v, want ErrConnectionClosed", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if enqueues != 1 {
+		t.Fatalf("ENQUEUE sent %d times, want 1", enqueues)
+	}
+}
+
+func TestResendsShareReconnectBudget(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		conns = map[*fakeConn]bool{}
+	)
+	s := newFakeServer(t, func(fc *fakeConn, command string) {
+		mu.Lock()
+		conns[fc] = true
+		mu.Unlock()
+		fc.conn.Close()
+	})
+	config := s.config()
+	config.Retry.MaxAttempts = 3
+	config.Retry.MinBackoff = time.Millisecond
+	client, err := createClient(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.Ping(); !errors.Is(err, ErrConnectionClosed) {
+		t.Fatalf("Ping returned %v, want ErrConnectionClosed", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// The first connection plus at most MaxAttempts reconnects.
+	if len(conns) != 1+config.Retry.MaxAttempts {
+		t.Fatalf("PING sent on %d connections, want %d", len(conns), 1+config.Retry.MaxAttempts)
+	}
+}
@@ -0,0 +1,121 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer speaks enough of the TempDB protocol to exercise the connection
+// layer: it authenticates every connection and passes each command to handle.
+type fakeServer struct {
+	t      *testing.T
+	ln     net.Listener
+	handle func(fc *fakeConn, command string)
+
+	mu        sync.Mutex
+	conns     []*fakeConn
+	authDelay time.Duration
+}
+
+// fakeConn is one client connection accepted by a fakeServer.
+type fakeConn struct {
+	conn net.Conn
+	mu   sync.Mutex
+}
+
+func newFakeServer(t *testing.T, handle func(fc *fakeConn, command string)) *fakeServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{t: t, ln: ln, handle: handle}
+	go s.serve()
+	t.Cleanup(s.close)
+	return s
+}
+
+func (s *fakeServer) config() Config {
+	return Config{Addr: s.ln.Addr().String(), URL: "tempdb://" + s.t.Name()}
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		fc := &fakeConn{conn: conn}
+		s.mu.Lock()
+		s.conns = append(s.conns, fc)
+		s.mu.Unlock()
+		go s.serveConn(fc)
+	}
+}
+
+// setAuthDelay makes the server wait d before accepting each authentication.
+func (s *fakeServer) setAuthDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authDelay = d
+}
+
+func (s *fakeServer) serveConn(fc *fakeConn) {
+	br := bufio.NewReader(fc.conn)
+	if _, err := br.ReadString('\n'); err != nil {
+		return
+	}
+	s.mu.Lock()
+	delay := s.authDelay
+	s.mu.Unlock()
+	time.Sleep(delay)
+	fc.send("AUTH OK session")
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return
+		}
+		_, command, _ := strings.Cut(strings.TrimSpace(line), " ")
+		s.handle(fc, command)
+	}
+}
+
+// dropAll closes every connection accepted so far.
+func (s *fakeServer) dropAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, fc := range s.conns {
+		fc.conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *fakeServer) close() {
+	s.ln.Close()
+	s.dropAll()
+}
+
+// send writes line to the client, ignoring errors from a closed connection.
+func (fc *fakeConn) send(line string) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fmt.Fprintf(fc.conn, "%s\n", line)
+}
+
+// reply sends a successful reply carrying data of the given type.
+func (fc *fakeConn) reply(typ string, data interface{}) {
+	raw, _ := json.Marshal(data)
+	resp, _ := json.Marshal(Response{Status: "ok", Data: json.RawMessage(fmt.Sprintf(`{"type":%q,"data":%s}`, typ, raw))})
+	fc.send(string(resp))
+}
+
+// ok sends a successful String reply.
+func (fc *fakeConn) ok() {
+	fc.reply(TypeString, "OK")
+}
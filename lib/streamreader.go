@@ -0,0 +1,169 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"time"
+)
+
+const (
+	defaultStreamBatch = 100
+	defaultStreamBlock = 30 * time.Second
+)
+
+// Special start positions for a StreamReader.
+const (
+	StreamStart = "-" // StreamStart reads the stream from its first entry.
+	StreamEnd   = "$" // StreamEnd reads only entries added after the reader starts.
+)
+
+// StreamEntry is an entry read from an event stream.
+type StreamEntry struct {
+	ID     string                 // ID is the entry's ID.
+	Values map[string]interface{} // Values is the entry as returned by XReadBlocking.
+}
+
+// StreamReaderOptions configures a StreamReader. The zero value reads the stream
+// from the beginning, 100 entries at a time.
+type StreamReaderOptions struct {
+	StartID string        // StartID is StreamStart, StreamEnd or the ID of the entry to start after; "" means StreamStart.
+	Count   int           // Count is how many entries each read fetches; 0 means 100.
+	Block   time.Duration // Block bounds each wait on the server for new entries, after which the read is repeated; 0 means 30s.
+}
+
+// StreamReader tails an event stream, returning every entry once and in order. It
+// keeps the ID of the last entry it returned, so a read that fails can simply be
+// retried. While the stream is idle it waits on the server with XReadBlocking,
+// which returns as soon as an entry is added. A StreamReader is not safe for
+// concurrent use.
+//
+//	reader := client.NewStreamReader("user_events", tempdb.StreamReaderOptions{StartID: tempdb.StreamEnd})
+//	for entry, err := range reader.All(ctx) {
+//		if err != nil {
+//			log.Println(err)
+//			break
+//		}
+//		log.Println(entry.ID, entry.Values)
+//	}
+type StreamReader struct {
+	client    *TempDBClient
+	streamKey string
+	opts      StreamReaderOptions
+
+	lastID   string        // lastID is the ID of the last entry returned, or the start position.
+	resolved bool          // resolved is set once a StreamEnd start has been turned into an entry ID.
+	buffered []StreamEntry // buffered holds fetched entries not yet returned.
+}
+
+// NewStreamReader returns a reader for streamKey positioned as opts.StartID describes.
+func (c *TempDBClient) NewStreamReader(streamKey string, opts StreamReaderOptions) *StreamReader {
+	if opts.StartID == "" {
+		opts.StartID = StreamStart
+	}
+	if opts.Count <= 0 {
+		opts.Count = defaultStreamBatch
+	}
+	if opts.Block <= 0 {
+		opts.Block = defaultStreamBlock
+	}
+	return &StreamReader{
+		client:    c,
+		streamKey: streamKey,
+		opts:      opts,
+		lastID:    opts.StartID,
+		resolved:  opts.StartID != StreamEnd,
+	}
+}
+
+// LastID returns the ID of the last entry returned by Next, or the start position
+// if none has been returned yet. Passing it as StartID resumes after that entry.
+func (r *StreamReader) LastID() string {
+	return r.lastID
+}
+
+// Next returns the next entry, waiting for one to be added if the reader has
+// caught up with the stream. It returns ctx's error if ctx is done first.
+func (r *StreamReader) Next(ctx context.Context) (StreamEntry, error) {
+	for len(r.buffered) == 0 {
+		if err := r.fetch(ctx); err != nil {
+			return StreamEntry{}, err
+		}
+	}
+
+	entry := r.buffered[0]
+	r.buffered = r.buffered[1:]
+	r.lastID = entry.ID
+	return entry, nil
+}
+
+// All returns an iterator over the stream's entries that ends after yielding the
+// first error, including ctx's error once ctx is done.
+func (r *StreamReader) All(ctx context.Context) iter.Seq2[StreamEntry, error] {
+	return func(yield func(StreamEntry, error) bool) {
+		for {
+			entry, err := r.Next(ctx)
+			if !yield(entry, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// fetch waits up to Block for the entries after lastID and buffers them.
+func (r *StreamReader) fetch(ctx context.Context) error {
+	if !r.resolved {
+		lastID, err := r.endID(ctx)
+		if err != nil {
+			return err
+		}
+		r.lastID, r.resolved = lastID, true
+	}
+
+	entries, err := r.read(ctx, r.lastID)
+	if err != nil {
+		return err
+	}
+	r.buffered = entries
+	return nil
+}
+
+// read returns the entries following afterID, waiting up to Block for the first.
+// Should the server include afterID itself, it is dropped; one entry more than
+// Count is requested so that a full batch of new entries still arrives then.
+func (r *StreamReader) read(ctx context.Context, afterID string) ([]StreamEntry, error) {
+	results, err := r.client.XReadBlockingContext(ctx, r.streamKey, afterID, r.opts.Count+1, r.opts.Block)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]StreamEntry, 0, len(results))
+	for _, values := range results {
+		id, ok := values["id"].(string)
+		if !ok {
+			return nil, fmt.Errorf("stream entry has no id: %v", values)
+		}
+		if id == afterID {
+			continue
+		}
+		entries = append(entries, StreamEntry{ID: id, Values: values})
+	}
+	return entries, nil
+}
+
+// endID returns the ID of the stream's last entry, or StreamStart if it is empty.
+func (r *StreamReader) endID(ctx context.Context) (string, error) {
+	results, err := r.client.XRevRangeContext(ctx, r.streamKey, RangeMax, RangeMin, 1)
+	if errors.Is(err, ErrNotFound) || err == nil && len(results) == 0 {
+		return StreamStart, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	id, ok := results[0]["id"].(string)
+	if !ok {
+		return "", fmt.Errorf("stream entry has no id: %v", results[0])
+	}
+	return id, nil
+}
@@ -0,0 +1,299 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// PendingEntry is a stream entry delivered to a consumer of a group but not yet acknowledged.
+type PendingEntry struct {
+	ID            string        // ID is the entry's ID.
+	Consumer      string        // Consumer is the consumer the entry was last delivered to.
+	Idle          time.Duration // Idle is the time since the entry was last delivered.
+	DeliveryCount int           // DeliveryCount is how many times the entry has been delivered.
+}
+
+// pendingEntry is the wire form of a PendingEntry.
+type pendingEntry struct {
+	ID            string `json:"id"`
+	Consumer      string `json:"consumer"`
+	IdleMillis    int64  `json:"idle_ms"`
+	DeliveryCount int    `json:"delivery_count"`
+}
+
+// XReadBlocking returns up to count entries added to a stream after afterID,
+// waiting up to timeout for one to be added if there are none yet. The server
+// replies as soon as an entry is added, so no polling is involved, and waits on a
+// stream that does not exist yet as on an empty one. It returns no entries and no
+// error if the wait timed out; a timeout of 0 waits indefinitely. Like
+// DequeueBlocking it is a blocking command.
+func (c *TempDBClient) XReadBlocking(streamKey, afterID string, count int, timeout time.Duration) ([]map[string]interface{}, error) {
+	return c.XReadBlockingContext(context.Background(), streamKey, afterID, count, timeout)
+}
+
+// XReadBlockingContext is like XReadBlocking but honours ctx, which may end the
+// wait before timeout; a cancelled wait closes the connection as
+// DequeueBlockingContext does.
+func (c *TempDBClient) XReadBlockingContext(ctx context.Context, streamKey, afterID string, count int, timeout time.Duration) ([]map[string]interface{}, error) {
+	cb := newCommand("BXREAD").int(millis(blockingTimeout(ctx, timeout))).key(streamKey).key(afterID).int(count)
+	responseData, err := c.doBlocking(ctx, cb)
+	if err != nil {
+		return nil, err
+	}
+	if responseData.Type == TypeNull {
+		return nil, nil
+	}
+	result, err := decodeResponseData(responseData)
+	if err != nil {
+		return nil, err
+	}
+	return streamEntries(result)
+}
+
+// XGroupCreate creates a consumer group on a stream. Consumers of a group share
+// the work of reading the stream: each entry is delivered to one of them and
+// stays pending until acknowledged with XAck, and entries left pending by a
+// consumer that died can be taken over with XClaim.
+//
+// The group's first read starts after startID; use "-" to deliver the whole
+// stream or "$" to deliver only entries added from now on.
+func (c *TempDBClient) XGroupCreate(streamKey, group, startID string) error {
+	return c.XGroupCreateContext(context.Background(), streamKey, group, startID)
+}
+
+// XGroupCreateContext is like XGroupCreate but honours ctx.
+func (c *TempDBClient) XGroupCreateContext(ctx context.Context, streamKey, group, startID string) error {
+	_, err := c.do(ctx, newCommand("XGROUP_CREATE").key(streamKey).key(group).key(startID))
+	return err
+}
+
+// XGroupDestroy deletes a consumer group and its pending entries.
+func (c *TempDBClient) XGroupDestroy(streamKey, group string) error {
+	return c.XGroupDestroyContext(context.Background(), streamKey, group)
+}
+
+// XGroupDestroyContext is like XGroupDestroy but honours ctx.
+func (c *TempDBClient) XGroupDestroyContext(ctx context.Context, streamKey, group string) error {
+	_, err := c.do(ctx, newCommand("XGROUP_DESTROY").key(streamKey).key(group))
+	return err
+}
+
+// XReadGroup reads up to count entries that have not been delivered to any
+// consumer of group, delivering them to consumer. They remain pending until
+// acknowledged with XAck.
+func (c *TempDBClient) XReadGroup(streamKey, group, consumer string, count int) ([]map[string]interface{}, error) {
+	return c.XReadGroupContext(context.Background(), streamKey, group, consumer, count)
+}
+
+// XReadGroupContext is like XReadGroup but honours ctx.
+func (c *TempDBClient) XReadGroupContext(ctx context.Context, streamKey, group, consumer string, count int) ([]map[string]interface{}, error) {
+	result, err := c.do(ctx, newCommand("XREADGROUP").key(streamKey).key(group).key(consumer).int(count))
+	if err != nil {
+		return nil, err
+	}
+	return streamEntries(result)
+}
+
+// XAck acknowledges entries processed by a consumer of group, removing them from
+// the pending list. It returns how many entries were acknowledged.
+func (c *TempDBClient) XAck(streamKey, group string, ids ...string) (int, error) {
+	return c.XAckContext(context.Background(), streamKey, group, ids...)
+}
+
+// XAckContext is like XAck but honours ctx.
+func (c *TempDBClient) XAckContext(ctx context.Context, streamKey, group string, ids ...string) (int, error) {
+	cb := newCommand("XACK").key(streamKey).key(group)
+	for _, id := range ids {
+		cb.key(id)
+	}
+	result, err := c.do(ctx, cb)
+	if err != nil {
+		return 0, err
+	}
+	return countResult(result)
+}
+
+// XPending lists the entries of group that were delivered but not acknowledged,
+// oldest first.
+func (c *TempDBClient) XPending(streamKey, group string) ([]PendingEntry, error) {
+	return c.XPendingContext(context.Background(), streamKey, group)
+}
+
+// XPendingContext is like XPending but honours ctx.
+func (c *TempDBClient) XPendingContext(ctx context.Context, streamKey, group string) ([]PendingEntry, error) {
+	responseData, err := c.doRaw(ctx, newCommand("XPENDING").key(streamKey).key(group))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := decodeAs[[]pendingEntry](responseData)
+	if err != nil {
+		return nil, err
+	}
+	pending := make([]PendingEntry, len(raw))
+	for i, p := range raw {
+		pending[i] = PendingEntry{
+			ID:            p.ID,
+			Consumer:      p.Consumer,
+			Idle:          time.Duration(p.IdleMillis) * time.Millisecond,
+			DeliveryCount: p.DeliveryCount,
+		}
+	}
+	return pending, nil
+}
+
+// XClaim transfers pending entries of group that have been idle for at least
+// minIdle to consumer and returns them. Entries that were acknowledged or
+// delivered again in the meantime are left alone, so a consumer that died can be
+// replaced safely by several others.
+func (c *TempDBClient) XClaim(streamKey, group, consumer string, minIdle time.Duration, ids ...string) ([]map[string]interface{}, error) {
+	return c.XClaimContext(context.Background(), streamKey, group, consumer, minIdle, ids...)
+}
+
+// XClaimContext is like XClaim but honours ctx.
+func (c *TempDBClient) XClaimContext(ctx context.Context, streamKey, group, consumer string, minIdle time.Duration, ids ...string) ([]map[string]interface{}, error) {
+	cb := newCommand("XCLAIM").key(streamKey).key(group).key(consumer).int(millis(minIdle))
+	for _, id := range ids {
+		cb.key(id)
+	}
+	result, err := c.do(ctx, cb)
+	if err != nil {
+		return nil, err
+	}
+	return streamEntries(result)
+}
+
+// Special IDs bounding an XRange or XRevRange.
+const (
+	RangeMin = "-" // RangeMin is before the stream's first entry.
+	RangeMax = "+" // RangeMax is after the stream's last entry.
+)
+
+// XRange returns up to count entries with IDs from start to end inclusive, oldest
+// first. Use RangeMin and RangeMax for an open range; count <= 0 means no limit.
+func (c *TempDBClient) XRange(streamKey, start, end string, count int) ([]map[string]interface{}, error) {
+	return c.XRangeContext(context.Background(), streamKey, start, end, count)
+}
+
+// XRangeContext is like XRange but honours ctx.
+func (c *TempDBClient) XRangeContext(ctx context.Context, streamKey, start, end string, count int) ([]map[string]interface{}, error) {
+	result, err := c.do(ctx, withCount(newCommand("XRANGE").key(streamKey).key(start).key(end), count))
+	if err != nil {
+		return nil, err
+	}
+	return streamEntries(result)
+}
+
+// XRevRange is like XRange but returns the entries newest first, starting from end.
+func (c *TempDBClient) XRevRange(streamKey, end, start string, count int) ([]map[string]interface{}, error) {
+	return c.XRevRangeContext(context.Background(), streamKey, end, start, count)
+}
+
+// XRevRangeContext is like XRevRange but honours ctx.
+func (c *TempDBClient) XRevRangeContext(ctx context.Context, streamKey, end, start string, count int) ([]map[string]interface{}, error) {
+	result, err := c.do(ctx, withCount(newCommand("XREVRANGE").key(streamKey).key(end).key(start), count))
+	if err != nil {
+		return nil, err
+	}
+	return streamEntries(result)
+}
+
+// withCount appends count to cb when it sets a limit.
+func withCount(cb *commandBuilder, count int) *commandBuilder {
+	if count > 0 {
+		cb.int(count)
+	}
+	return cb
+}
+
+// XLen returns the number of entries in a stream.
+func (c *TempDBClient) XLen(streamKey string) (int, error) {
+	return c.XLenContext(context.Background(), streamKey)
+}
+
+// XLenContext is like XLen but honours ctx.
+func (c *TempDBClient) XLenContext(ctx context.Context, streamKey string) (int, error) {
+	result, err := c.do(ctx, newCommand("XLEN").key(streamKey))
+	if err != nil {
+		return 0, err
+	}
+	return countResult(result)
+}
+
+// XDelEntries deletes individual entries from a stream, unlike XDel which deletes
+// the whole stream. It returns how many entries were deleted.
+func (c *TempDBClient) XDelEntries(streamKey string, ids ...string) (int, error) {
+	return c.XDelEntriesContext(context.Background(), streamKey, ids...)
+}
+
+// XDelEntriesContext is like XDelEntries but honours ctx.
+func (c *TempDBClient) XDelEntriesContext(ctx context.Context, streamKey string, ids ...string) (int, error) {
+	cb := newCommand("XDEL_ENTRIES").key(streamKey)
+	for _, id := range ids {
+		cb.key(id)
+	}
+	result, err := c.do(ctx, cb)
+	if err != nil {
+		return 0, err
+	}
+	return countResult(result)
+}
+
+// XTrimMaxLen deletes the oldest entries of a stream until at most maxLen remain.
+// It returns how many entries were deleted.
+func (c *TempDBClient) XTrimMaxLen(streamKey string, maxLen int) (int, error) {
+	return c.XTrimMaxLenContext(context.Background(), streamKey, maxLen)
+}
+
+// XTrimMaxLenContext is like XTrimMaxLen but honours ctx.
+func (c *TempDBClient) XTrimMaxLenContext(ctx context.Context, streamKey string, maxLen int) (int, error) {
+	return c.xtrim(ctx, newCommand("XTRIM").key(streamKey).key("MAXLEN").int(maxLen))
+}
+
+// XTrimMinID deletes the entries of a stream whose IDs are lower than minID.
+// It returns how many entries were deleted.
+func (c *TempDBClient) XTrimMinID(streamKey, minID string) (int, error) {
+	return c.XTrimMinIDContext(context.Background(), streamKey, minID)
+}
+
+// XTrimMinIDContext is like XTrimMinID but honours ctx.
+func (c *TempDBClient) XTrimMinIDContext(ctx context.Context, streamKey, minID string) (int, error) {
+	return c.xtrim(ctx, newCommand("XTRIM").key(streamKey).key("MINID").key(minID))
+}
+
+// XTrimMaxAge deletes the entries of a stream added more than maxAge ago.
+// It returns how many entries were deleted.
+func (c *TempDBClient) XTrimMaxAge(streamKey string, maxAge time.Duration) (int, error) {
+	return c.XTrimMaxAgeContext(context.Background(), streamKey, maxAge)
+}
+
+// XTrimMaxAgeContext is like XTrimMaxAge but honours ctx.
+func (c *TempDBClient) XTrimMaxAgeContext(ctx context.Context, streamKey string, maxAge time.Duration) (int, error) {
+	return c.xtrim(ctx, newCommand("XTRIM").key(streamKey).key("MAXAGE").int(millis(maxAge)))
+}
+
+func (c *TempDBClient) xtrim(ctx context.Context, cb *commandBuilder) (int, error) {
+	result, err := c.do(ctx, cb)
+	if err != nil {
+		return 0, err
+	}
+	return countResult(result)
+}
+
+// countResult converts a result reporting a number of items into an int.
+func countResult(result interface{}) (int, error) {
+	switch n := result.(type) {
+	case int64:
+		return int(n), nil
+	case float64:
+		return int(n), nil
+	case string:
+		count, err := strconv.Atoi(n)
+		if err != nil {
+			return 0, fmt.Errorf("unexpected response: %v", result)
+		}
+		return count, nil
+	}
+	return 0, fmt.Errorf("unexpected response: %v", result)
+}
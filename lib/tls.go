@@ -0,0 +1,117 @@
+package lib
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+const (
+	// schemePlain is the URL scheme of a plaintext TempDB connection string.
+	schemePlain = "tempdb://"
+	// schemeTLS is the URL scheme that enables TLS. The server only understands
+	// schemePlain, so it is rewritten before the connection string is sent.
+	schemeTLS = "tempdbs://"
+)
+
+// TLSOptions describes the certificates used to build a *tls.Config for TempDB.
+// Use it when the certificates live on disk or in PEM form; set Config.TLSConfig
+// directly for anything more specialised.
+type TLSOptions struct {
+	ServerName         string // ServerName overrides the host name verified against the server certificate.
+	CAFile             string // CAFile is a PEM bundle of CAs trusted in addition to CAPEM.
+	CAPEM              []byte // CAPEM holds PEM encoded CA certificates.
+	CertFile           string // CertFile is the PEM client certificate presented for mutual TLS.
+	KeyFile            string // KeyFile is the PEM private key matching CertFile.
+	InsecureSkipVerify bool   // InsecureSkipVerify disables server certificate verification. Testing only.
+}
+
+// NewTLSConfig builds a *tls.Config from opts. When neither CAFile nor CAPEM is
+// set the system root pool is used; CertFile and KeyFile must be set together.
+func NewTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         opts.ServerName,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if opts.CAFile != "" || len(opts.CAPEM) > 0 {
+		roots := x509.NewCertPool()
+		if opts.CAFile != "" {
+			pem, err := os.ReadFile(opts.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA file: %w", err)
+			}
+			if !roots.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in CA file %s", opts.CAFile)
+			}
+		}
+		if len(opts.CAPEM) > 0 && !roots.AppendCertsFromPEM(opts.CAPEM) {
+			return nil, fmt.Errorf("no certificates found in CA PEM")
+		}
+		cfg.RootCAs = roots
+	}
+
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return nil, fmt.Errorf("client certificate and key must be provided together")
+	}
+	if opts.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// usesTLS reports whether connections for this configuration must be encrypted.
+func (config Config) usesTLS() bool {
+	return config.UseTLS || config.TLSConfig != nil || strings.HasPrefix(config.URL, schemeTLS)
+}
+
+// connectionString returns the URL sent to the server, with the tempdbs scheme
+// replaced by the plain scheme the server authenticates against.
+func (config Config) connectionString() string {
+	if strings.HasPrefix(config.URL, schemeTLS) {
+		return schemePlain + strings.TrimPrefix(config.URL, schemeTLS)
+	}
+	return config.URL
+}
+
+// tlsConfig returns the TLS configuration for dialing config.Addr. The server name
+// defaults to the host part of the address so the certificate is always verified
+// against the host being dialed.
+func (config Config) tlsConfig() *tls.Config {
+	var cfg *tls.Config
+	if config.TLSConfig != nil {
+		cfg = config.TLSConfig.Clone()
+	} else {
+		cfg = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(config.Addr)
+		if err != nil {
+			host = config.Addr
+		}
+		cfg.ServerName = host
+	}
+	return cfg
+}
+
+// dial opens a connection to config.Addr, performing the TLS handshake when
+// the configuration asks for it.
+func dial(ctx context.Context, config Config) (net.Conn, error) {
+	if !config.usesTLS() {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", config.Addr)
+	}
+
+	dialer := tls.Dialer{Config: config.tlsConfig()}
+	return dialer.DialContext(ctx, "tcp", config.Addr)
+}
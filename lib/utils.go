@@ -4,12 +4,14 @@ package lib
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 )
 
 // Response represents a standard response structure with a status, message, and data.
 type Response struct {
 	Status  string          `json:"status"`
 	Message string          `json:"message,omitempty"`
+	Code    string          `json:"code,omitempty"`
 	Data    json.RawMessage `json:"data"`
 }
 
@@ -19,6 +21,68 @@ type ResponseData struct {
 	Data json.RawMessage `json:"data"`
 }
 
+// Values of ResponseData.Type understood by the client.
+const (
+	TypeString  = "String"  // TypeString decodes to string.
+	TypeJson    = "Json"    // TypeJson decodes to the interface{} form of the JSON value.
+	TypeList    = "List"    // TypeList decodes to []string.
+	TypeSet     = "Set"     // TypeSet decodes to []string.
+	TypeBatch   = "Batch"   // TypeBatch decodes to map[string]string.
+	TypeInteger = "Integer" // TypeInteger decodes to int64.
+	TypeFloat   = "Float"   // TypeFloat decodes to float64.
+	TypeBoolean = "Boolean" // TypeBoolean decodes to bool.
+	TypeNull    = "Null"    // TypeNull decodes to nil.
+	TypeVector  = "Vector"  // TypeVector decodes to []float32.
+	TypeMap     = "Map"     // TypeMap decodes to map[string]interface{}.
+	TypeArray   = "Array"   // TypeArray decodes to []interface{}, nesting arrays and objects as JSON does.
+)
+
+// decodeResponseData converts responseData into the Go value for its type.
+// Types the client does not know are returned as the ResponseData itself, so
+// callers can decode newer server types without waiting for a client release.
+func decodeResponseData(responseData ResponseData) (interface{}, error) {
+	var result interface{}
+	var err error
+	switch responseData.Type {
+	case TypeString:
+		result, err = unmarshalAs[string](responseData.Data)
+	case TypeJson:
+		result, err = unmarshalAs[interface{}](responseData.Data)
+	case TypeList, TypeSet:
+		result, err = unmarshalAs[[]string](responseData.Data)
+	case TypeBatch:
+		result, err = unmarshalAs[map[string]string](responseData.Data)
+	case TypeInteger:
+		result, err = unmarshalAs[int64](responseData.Data)
+	case TypeFloat:
+		result, err = unmarshalAs[float64](responseData.Data)
+	case TypeBoolean:
+		result, err = unmarshalAs[bool](responseData.Data)
+	case TypeNull:
+		return nil, nil
+	case TypeVector:
+		result, err = unmarshalAs[[]float32](responseData.Data)
+	case TypeMap:
+		result, err = unmarshalAs[map[string]interface{}](responseData.Data)
+	case TypeArray:
+		result, err = unmarshalAs[[]interface{}](responseData.Data)
+	default:
+		return responseData, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s response: %w", responseData.Type, err)
+	}
+	return result, nil
+}
+
+// unmarshalAs decodes data into a T.
+func unmarshalAs[T any](data json.RawMessage) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
 // FormattedResponse represents a formatted response with additional metadata such as type, value, creation time, and expiry time.
 type FormattedResponse struct {
 	Type      string      `json:"type"`
@@ -36,3 +100,13 @@ func formatResponse(data interface{}) (string, error) {
 	}
 	return string(formatted), nil
 }
+
+// millis converts d to whole milliseconds, rounding a positive duration below
+// one millisecond up so it is not mistaken for zero.
+func millis(d time.Duration) int {
+	ms := int(d.Milliseconds())
+	if d > 0 && ms == 0 {
+		return 1
+	}
+	return max(ms, 0)
+}
@@ -0,0 +1,55 @@
+package lib
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeResponseData(t *testing.T) {
+	tests := []struct {
+		typ  string
+		data string
+		want interface{}
+	}{
+		{TypeString, `"hello"`, "hello"},
+		{TypeJson, `{"a":[1,"b"]}`, map[string]interface{}{"a": []interface{}{1.0, "b"}}},
+		{TypeList, `["a","b"]`, []string{"a", "b"}},
+		{TypeSet, `["x"]`, []string{"x"}},
+		{TypeBatch, `{"k":"v"}`, map[string]string{"k": "v"}},
+		{TypeInteger, `9007199254740993`, int64(9007199254740993)},
+		{TypeFloat, `1.5`, 1.5},
+		{TypeBoolean, `true`, true},
+		{TypeNull, `null`, nil},
+		{TypeVector, `[0.5,1]`, []float32{0.5, 1}},
+		{TypeMap, `{"n":1}`, map[string]interface{}{"n": 1.0}},
+		{TypeArray, `[1,[2],{"c":3}]`, []interface{}{1.0, []interface{}{2.0}, map[string]interface{}{"c": 3.0}}},
+	}
+	for _, tt := range tests {
+		got, err := decodeResponseData(ResponseData{Type: tt.typ, Data: json.RawMessage(tt.data)})
+		if err != nil {
+			t.Errorf("decode %s %s: %v", tt.typ, tt.data, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("decode %s %s = %#v, want %#v", tt.typ, tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeResponseDataUnknownType(t *testing.T) {
+	in := ResponseData{Type: "Geo", Data: json.RawMessage(`{"lat":1}`)}
+	got, err := decodeResponseData(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, in) {
+		t.Fatalf("decode unknown type = %#v, want the ResponseData unchanged", got)
+	}
+}
+
+func TestDecodeResponseDataMismatch(t *testing.T) {
+	if got, err := decodeResponseData(ResponseData{Type: TypeInteger, Data: json.RawMessage(`"one"`)}); err == nil {
+		t.Fatalf("decode Integer \"one\" = %#v, want an error", got)
+	}
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"time"
 
 	"github.com/tempdb-labs/tempdb-go/lib"
+	"github.com/tempdb-labs/tempdb-go/worker"
 )
 
 func main() {
@@ -31,14 +33,18 @@ func RunChatService(config lib.Config) {
 	}
 	defer client.Close()
 
-	// Subscribe to the chat channel
-	err = client.Subscribe("chatroom", func(message string) {
-		fmt.Printf("[Chat] Received: %s\n", message)
-	})
+	// Subscribe to the chat channel on a connection of its own
+	pubsub, err := lib.NewPubSub(config, "chatroom")
 	if err != nil {
 		log.Printf("Chat subscribe error: %v", err)
 		return
 	}
+	defer pubsub.Close()
+	go func() {
+		for msg := range pubsub.Channel() {
+			fmt.Printf("[Chat] Received on %s: %s\n", msg.Channel, msg.Payload)
+		}
+	}()
 
 	// Publish messages periodically
 	go func() {
@@ -119,22 +125,16 @@ func RunTaskProcessor(config lib.Config) {
 		time.Sleep(500 * time.Millisecond)
 	}
 
-	// Process tasks
-	go func() {
-		for {
-			task, err := client.Dequeue("task_queue")
-			if err != nil {
-				if err.Error() != "EMPTY" {
-					log.Printf("Dequeue error: %v", err)
-				}
-				time.Sleep(1 * time.Second)
-				continue
-			}
-			fmt.Printf("[Processor] Processing task: %v\n", task)
-			time.Sleep(2 * time.Second) // Simulate work
+	// Process tasks with a worker pool that waits on the server for each one
+	w := worker.New(config, worker.Options{Concurrency: 2, JobTimeout: time.Minute})
+	w.Handle("task_queue", func(ctx context.Context, job *worker.Job) error {
+		var task map[string]string
+		if err := job.Decode(&task); err != nil {
+			return err
 		}
-	}()
-
-	// Keep running
-	select {}
+		fmt.Printf("[Processor] Processing task: %v\n", task)
+		time.Sleep(2 * time.Second) // Simulate work
+		return nil
+	})
+	w.Run(context.Background())
 }
@@ -0,0 +1,304 @@
+// Package worker runs handlers for messages on TempDB queues. It replaces the
+// hand-written dequeue loop every consumer otherwise needs: messages are leased
+// with DequeueLeaseBlocking, handled by a pool of goroutines per queue, kept
+// leased while their handler runs, retried with backoff when the handler fails,
+// and acknowledged once handled. Handler panics are recovered and treated as
+// failures, and cancelling Run's context stops new work while letting jobs in
+// flight finish.
+//
+//	w := worker.New(config, worker.Options{Concurrency: 4, JobTimeout: time.Minute})
+//	w.Handle("task_queue", func(ctx context.Context, job *worker.Job) error {
+//		var task Task
+//		if err := job.Decode(&task); err != nil {
+//			return err
+//		}
+//		return process(ctx, task)
+//	})
+//	err := w.Run(ctx)
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/tempdb-labs/tempdb-go/lib"
+)
+
+const (
+	defaultMaxAttempts = 3
+	defaultMinBackoff  = time.Second
+	defaultMaxBackoff  = 30 * time.Second
+	defaultVisibility  = 30 * time.Second
+
+	// leaseWait bounds each wait on the server for a message, after which it is repeated.
+	leaseWait = 30 * time.Second
+)
+
+// Options configures a Worker. The zero value runs one goroutine per queue and
+// makes up to 3 attempts per delivery, backing off from 1s to 30s between them.
+type Options struct {
+	Concurrency int           // Concurrency is how many jobs of each queue run at once; 0 means 1.
+	MaxAttempts int           // MaxAttempts bounds handler calls per delivery; 0 means 3. See HandlerFunc for how it combines with a DeadLetterPolicy.
+	MinBackoff  time.Duration // MinBackoff is the delay before the second attempt; 0 means 1s.
+	MaxBackoff  time.Duration // MaxBackoff caps the delay between attempts; 0 means 30s.
+	JobTimeout  time.Duration // JobTimeout bounds each handler call; 0 means no limit.
+	Visibility  time.Duration // Visibility is the lease taken on each message, renewed every Visibility/2 until it is settled; 0 means 30s.
+
+	// ErrorHandler is called with failures that are not returned to a caller:
+	// handler errors after the last attempt, recovered panics and failed queue
+	// commands. It defaults to logging them.
+	ErrorHandler func(queueKey string, err error)
+}
+
+// Job is a message being handled.
+type Job struct {
+	Queue    string        // Queue is the queue the message came from.
+	Attempt  int           // Attempt counts handler calls for this delivery, starting at 1.
+	Delivery *lib.Delivery // Delivery is the leased message, for its ID, payload and delivery count; the worker settles and renews it, without updating LeaseExpiresAt.
+}
+
+// Decode unmarshals the message into v.
+func (j *Job) Decode(v interface{}) error {
+	return j.Delivery.Decode(v)
+}
+
+// HandlerFunc handles one job. Returning nil acknowledges the message; returning
+// an error retries it, and after the last attempt rejects it with that error so
+// the queue's DeadLetterPolicy, if any, can take over.
+//
+// Retries within a delivery and redeliveries multiply: a message is handled up to
+// MaxAttempts times per delivery and delivered up to the policy's MaxDeliveries
+// times, so with both at 3 a failing handler runs 9 times before the message is
+// dead-lettered. Set MaxAttempts to 1 to leave retries to the server's delivery
+// count, which Job.Delivery.DeliveryCount reports.
+type HandlerFunc func(ctx context.Context, job *Job) error
+
+// PanicError is the error a handler's panic is turned into. Its message is kept
+// short so it can be recorded with the message; Stack holds the goroutine trace.
+type PanicError struct {
+	Value interface{} // Value is the value passed to panic.
+	Stack []byte      // Stack is the stack trace at the time of the panic.
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Worker dispatches queue messages to registered handlers.
+type Worker struct {
+	config   lib.Config
+	opts     Options
+	handlers map[string]HandlerFunc
+}
+
+// New returns a worker for the queues of config. Because each consumer waits on
+// the server for its next message, Run checks a client out of config's pool for
+// every consumer, Concurrency per queue, and returns them when it stops.
+func New(config lib.Config, opts Options) *Worker {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = defaultMinBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaultMaxBackoff
+	}
+	if opts.Visibility <= 0 {
+		opts.Visibility = defaultVisibility
+	}
+	if opts.ErrorHandler == nil {
+		opts.ErrorHandler = func(queueKey string, err error) {
+			log.Printf("worker: %s: %v", queueKey, err)
+		}
+	}
+	return &Worker{config: config, opts: opts, handlers: map[string]HandlerFunc{}}
+}
+
+// Handle registers handler for the messages of queueKey, replacing any handler
+// registered before. It must be called before Run.
+func (w *Worker) Handle(queueKey string, handler HandlerFunc) {
+	w.handlers[queueKey] = handler
+}
+
+// Run handles messages until ctx is done, then waits for the jobs in flight to
+// finish before returning. Jobs keep running after ctx is done, bounded only by
+// JobTimeout, but are not retried; a message whose job fails then is rejected
+// so another consumer can pick it up. Run returns an error without handling any
+// message if a client cannot be checked out for every consumer.
+func (w *Worker) Run(ctx context.Context) error {
+	if len(w.handlers) == 0 {
+		return errors.New("worker: no handlers registered")
+	}
+
+	var clients []*lib.TempDBClient
+	defer func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}()
+	for range len(w.handlers) * w.opts.Concurrency {
+		client, err := lib.NewClientContext(ctx, w.config)
+		if err != nil {
+			return fmt.Errorf("worker: %w", err)
+		}
+		clients = append(clients, client)
+	}
+
+	var wg sync.WaitGroup
+	next := 0
+	for queueKey, handler := range w.handlers {
+		for _, client := range clients[next : next+w.opts.Concurrency] {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				w.consume(ctx, client, queueKey, handler)
+			}()
+		}
+		next += w.opts.Concurrency
+	}
+	wg.Wait()
+	return nil
+}
+
+// consume leases and handles messages from queueKey until ctx is done, waiting on
+// the server while the queue is empty and backing off after failed commands.
+func (w *Worker) consume(ctx context.Context, client *lib.TempDBClient, queueKey string, handler HandlerFunc) {
+	failures := 0
+	for ctx.Err() == nil {
+		delivery, err := client.DequeueLeaseBlockingContext(ctx, queueKey, w.opts.Visibility, leaseWait)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if !errors.Is(err, lib.ErrQueueTimeout) {
+				w.opts.ErrorHandler(queueKey, fmt.Errorf("failed to dequeue: %w", err))
+				failures++
+				sleep(ctx, w.backoff(failures))
+			}
+			continue
+		}
+
+		failures = 0
+		w.process(ctx, queueKey, handler, delivery)
+	}
+}
+
+// process runs handler for delivery, retrying with backoff, and then acknowledges
+// or rejects the message. The lease is renewed in the background until then, and
+// if it is lost the handler's context is cancelled, since the message is being
+// delivered to another consumer. Queue commands are sent even after ctx is done
+// so the outcome of a finished job is never lost.
+func (w *Worker) process(ctx context.Context, queueKey string, handler HandlerFunc, delivery *lib.Delivery) {
+	settleCtx := context.WithoutCancel(ctx)
+	jobCtx, cancel := context.WithCancelCause(settleCtx)
+	defer cancel(nil)
+	stop := w.renew(queueKey, delivery, cancel)
+	job := &Job{Queue: queueKey, Delivery: delivery}
+
+	var err error
+	for job.Attempt = 1; ; job.Attempt++ {
+		if err = w.call(jobCtx, handler, job); err == nil || job.Attempt >= w.opts.MaxAttempts {
+			break
+		}
+		if !sleep(ctx, w.backoff(job.Attempt)) || jobCtx.Err() != nil {
+			break
+		}
+	}
+
+	stop()
+	if cause := context.Cause(jobCtx); cause != nil {
+		w.opts.ErrorHandler(queueKey, cause)
+		return
+	}
+	if err == nil {
+		if err := delivery.AckContext(settleCtx); err != nil {
+			w.opts.ErrorHandler(queueKey, fmt.Errorf("failed to acknowledge message %s: %w", delivery.ID, err))
+		}
+		return
+	}
+	w.opts.ErrorHandler(queueKey, fmt.Errorf("message %s failed after %d attempts: %w", delivery.ID, job.Attempt, err))
+	if err := delivery.RejectContext(settleCtx, err); err != nil {
+		w.opts.ErrorHandler(queueKey, fmt.Errorf("failed to reject message %s: %w", delivery.ID, err))
+	}
+}
+
+// renew extends delivery's lease every Visibility/2 until the returned function is
+// called, which waits for any extension in progress. When the lease turns out to
+// have been lost, it stops and cancels the job with the reason. Extensions are
+// made on a copy of delivery, since the handler may read it concurrently.
+func (w *Worker) renew(queueKey string, delivery *lib.Delivery, cancel context.CancelCauseFunc) (stop func()) {
+	lease := *delivery
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(max(w.opts.Visibility/2, time.Millisecond))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+			err := lease.ExtendContext(context.Background(), w.opts.Visibility)
+			if errors.Is(err, lib.ErrNotFound) {
+				cancel(fmt.Errorf("lost lease on message %s: %w", lease.ID, err))
+				return
+			}
+			if err != nil {
+				w.opts.ErrorHandler(queueKey, fmt.Errorf("failed to extend lease on message %s: %w", lease.ID, err))
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// call runs handler under JobTimeout, turning a panic into a *PanicError.
+func (w *Worker) call(ctx context.Context, handler HandlerFunc, job *Job) (err error) {
+	if w.opts.JobTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.opts.JobTimeout)
+		defer cancel()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// backoff returns a random delay in [0, min(MaxBackoff, MinBackoff*2^(attempt-1))).
+func (w *Worker) backoff(attempt int) time.Duration {
+	ceiling := w.opts.MaxBackoff
+	if shift := attempt - 1; shift < 32 && w.opts.MinBackoff<<shift > 0 && w.opts.MinBackoff<<shift < ceiling {
+		ceiling = w.opts.MinBackoff << shift
+	}
+	return time.Duration(rand.Int64N(int64(ceiling)) + 1)
+}
+
+// sleep waits for d and reports whether it did so before ctx was done.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}